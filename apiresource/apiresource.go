@@ -5,6 +5,9 @@ package apiresource
 import (
 	"context"
 	"fmt"
+	"runtime"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type Renderable[TBundle any, TEntity any, TResource any, TParams any] interface {
@@ -12,7 +15,35 @@ type Renderable[TBundle any, TEntity any, TResource any, TParams any] interface
 	Render(context.Context, TParams, TBundle, TEntity) (TResource, error)
 }
 
+// RenderOptions configures how RenderMany renders resources.
+type RenderOptions struct {
+	// Concurrency is the maximum number of resources rendered in parallel.
+	//
+	// When Concurrency is 1 or less resources are rendered serially.
+	Concurrency int
+
+	// partial makes rendering collect errors of individual resources instead
+	// of failing the whole batch.
+	partial bool
+}
+
+// WithConcurrency sets the maximum number of resources rendered in parallel.
+//
+// If n is 0 or less, the concurrency is set to runtime.GOMAXPROCS(0).
+func WithConcurrency(n int) func(*RenderOptions) {
+	return func(opts *RenderOptions) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+
+		opts.Concurrency = n
+	}
+}
+
 // Render renders an API resource.
+//
+// If the resource implements Composite, its child resources are rendered
+// as well.
 func Render[
 	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
 	TBundle any,
@@ -23,22 +54,26 @@ func Render[
 	params TParams,
 	entity TEntity,
 ) (TRenderable, error) {
-	var renderable TRenderable
-
-	bundle, err := renderable.Bundle(ctx, params, []TEntity{entity})
-	if err != nil {
-		return renderable, fmt.Errorf("apiresource: error loading bundle: %w", err)
-	}
-
-	resource, err := renderable.Render(ctx, params, bundle, entity)
+	//nolint:exhaustruct
+	resources, _, err := renderMany[TBundle, TRenderable](ctx, params, []TEntity{entity}, RenderOptions{})
 	if err != nil {
-		return renderable, fmt.Errorf("apiresource: error rendering resource: %w", err)
+		var renderable TRenderable
+		return renderable, err
 	}
 
-	return resource, nil
+	return resources[0], nil
 }
 
 // RenderMany is similar to Render, but renders many API resources at once.
+//
+// Bundle is loaded once for all entities. Rendering happens serially unless
+// WithConcurrency is provided, in which case entities are rendered in parallel
+// and the first error cancels the remaining work. The order of the resulting
+// resources always matches the order of entities.
+//
+// If the resource implements Composite, child resources of all entities are
+// rendered level by level, so each child Bundle is loaded once per level
+// regardless of the number of entities.
 func RenderMany[
 	TBundle any,
 	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
@@ -48,20 +83,235 @@ func RenderMany[
 	ctx context.Context,
 	params TParams,
 	entities []TEntity,
+	opts ...func(*RenderOptions),
 ) ([]TRenderable, error) {
+	//nolint:exhaustruct
+	options := RenderOptions{}
+	for _, f := range opts {
+		f(&options)
+	}
+
+	resources, _, err := renderMany[TBundle, TRenderable](ctx, params, entities, options)
+
+	return resources, err
+}
+
+// RenderError is an error of rendering a single resource in RenderManyPartial.
+type RenderError struct {
+	// Err is the rendering error.
+	Err error
+
+	// Index is the index of the entity that failed to render.
+	Index int
+}
+
+func (e *RenderError) Error() string { return fmt.Sprintf("%v (index %d)", e.Err, e.Index) }
+func (e *RenderError) Unwrap() error { return e.Err }
+
+// RenderManyPartial is similar to RenderMany, but tolerates failures of
+// individual resources.
+//
+// It returns the successfully rendered resources in the order of entities,
+// and a RenderError for each entity that failed to render, including
+// failures of its child resources. An error is returned only if the batch
+// cannot be rendered at all, e.g. when loading a bundle fails.
+func RenderManyPartial[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	opts ...func(*RenderOptions),
+) ([]TRenderable, []*RenderError, error) {
+	//nolint:exhaustruct
+	options := RenderOptions{}
+	for _, f := range opts {
+		f(&options)
+	}
+
+	options.partial = true
+
+	resources, errs, err := renderMany[TBundle, TRenderable](ctx, params, entities, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var renderErrs []*RenderError
+
+	rendered := make([]TRenderable, 0, len(resources))
+	for i, r := range resources {
+		if errs[i] != nil {
+			renderErrs = append(renderErrs, &RenderError{Err: errs[i], Index: i})
+			continue
+		}
+
+		rendered = append(rendered, r)
+	}
+
+	return rendered, renderErrs, nil
+}
+
+// renderMany loads the bundle for entities, renders them and resolves
+// relations of the resulting resources.
+//
+// In the partial mode errors of individual resources are collected into
+// errs by their index instead of failing the whole batch, otherwise errs
+// is nil.
+func renderMany[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	options RenderOptions,
+) ([]TRenderable, []error, error) {
 	var renderable TRenderable
 
-	bundle, err := renderable.Bundle(ctx, params, entities)
+	bundleCtx, done := observeBundle[TRenderable](ctx, entities)
+	bundle, err := renderable.Bundle(bundleCtx, params, entities)
+	done()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("apiresource: error loading bundle: %w", err)
+	}
+
+	var errs []error
+	if options.partial {
+		errs = make([]error, len(entities))
+	}
+
+	var resources []TRenderable
+	if options.Concurrency > 1 {
+		resources, err = renderConcurrently[TBundle, TRenderable](
+			ctx,
+			params,
+			bundle,
+			entities,
+			errs,
+			options.Concurrency,
+		)
+	} else {
+		resources, err = renderSerially[TBundle, TRenderable](ctx, params, bundle, entities, errs)
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("apiresource: error loading bundle: %w", err)
+		return nil, nil, err
+	}
+
+	if composite, ok := any(renderable).(Composite[TEntity, TRenderable, TParams]); ok {
+		for i, rel := range composite.Relations() {
+			if err := rel.resolve(relationContext(ctx, i), params, entities, resources, errs, options); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
+	return resources, errs, nil
+}
+
+// renderSerially renders entities one by one.
+//
+// If errs is not nil, rendering errors are stored in errs instead of being returned.
+func renderSerially[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	bundle TBundle,
+	entities []TEntity,
+	errs []error,
+) ([]TRenderable, error) {
+	var renderable TRenderable
+
 	resources := make([]TRenderable, len(entities))
 	for i := range resources {
-		resources[i], err = renderable.Render(ctx, params, bundle, entities[i])
+		renderCtx, done := observeRender[TRenderable](ctx, entities[i])
+		resource, err := renderable.Render(renderCtx, params, bundle, entities[i])
+		done()
+
 		if err != nil {
-			return nil, fmt.Errorf("apiresource: error rendering resource: %w", err)
+			err = fmt.Errorf("apiresource: error rendering resource: %w", err)
+			if errs == nil {
+				return nil, err
+			}
+
+			errs[i] = err
+
+			continue
 		}
+
+		resources[i] = resource
+	}
+
+	return resources, nil
+}
+
+// renderConcurrently renders entities in parallel using at most limit goroutines.
+//
+// If errs is not nil, rendering errors are stored in errs instead of
+// cancelling the remaining work.
+func renderConcurrently[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	bundle TBundle,
+	entities []TEntity,
+	errs []error,
+	limit int,
+) ([]TRenderable, error) {
+	var renderable TRenderable
+
+	resources := make([]TRenderable, len(entities))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+
+	for i := range entities {
+		if gctx.Err() != nil {
+			break
+		}
+
+		g.Go(func() error {
+			renderCtx, done := observeRender[TRenderable](gctx, entities[i])
+			resource, err := renderable.Render(renderCtx, params, bundle, entities[i])
+			done()
+
+			if err != nil {
+				err = fmt.Errorf("apiresource: error rendering resource: %w", err)
+				if errs == nil {
+					return err
+				}
+
+				errs[i] = err
+
+				return nil
+			}
+
+			resources[i] = resource
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err //nolint:wrapcheck // errors are wrapped in the goroutine
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("apiresource: rendering cancelled: %w", err)
 	}
 
 	return resources, nil
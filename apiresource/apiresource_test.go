@@ -0,0 +1,131 @@
+package apiresource
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRender = errors.New("render failed")
+
+type userEntity struct {
+	ID   int
+	Name string
+}
+
+type userParams struct {
+	failOn int
+	delay  time.Duration
+}
+
+type userBundle struct {
+	prefix string
+}
+
+type userResource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+//nolint:gochecknoglobals
+var (
+	userBundleCalls atomic.Int64
+	userRenderCalls atomic.Int64
+)
+
+func (userResource) Bundle(_ context.Context, _ userParams, _ []userEntity) (userBundle, error) {
+	userBundleCalls.Add(1)
+	return userBundle{prefix: "usr_"}, nil
+}
+
+func (userResource) Render(
+	ctx context.Context,
+	params userParams,
+	bundle userBundle,
+	entity userEntity,
+) (userResource, error) {
+	userRenderCalls.Add(1)
+
+	if params.delay > 0 {
+		select {
+		case <-time.After(params.delay):
+		case <-ctx.Done():
+			return userResource{}, ctx.Err()
+		}
+	}
+
+	if params.failOn != 0 && entity.ID == params.failOn {
+		return userResource{}, errRender
+	}
+
+	return userResource{ID: bundle.prefix + strconv.Itoa(entity.ID), Name: entity.Name}, nil
+}
+
+func users(n int) []userEntity {
+	entities := make([]userEntity, n)
+	for i := range entities {
+		entities[i] = userEntity{ID: i + 1, Name: "user " + strconv.Itoa(i+1)}
+	}
+
+	return entities
+}
+
+func TestRender(t *testing.T) {
+	resource, err := Render[userResource](context.Background(), userParams{}, userEntity{ID: 1, Name: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, userResource{ID: "usr_1", Name: "alice"}, resource)
+}
+
+func TestRenderMany(t *testing.T) {
+	t.Run("serial", func(t *testing.T) {
+		resources, err := RenderMany[userBundle, userResource](context.Background(), userParams{}, users(3))
+		require.NoError(t, err)
+		require.Len(t, resources, 3)
+		assert.Equal(t, "usr_1", resources[0].ID)
+		assert.Equal(t, "usr_3", resources[2].ID)
+	})
+
+	t.Run("concurrent keeps input order", func(t *testing.T) {
+		entities := users(100)
+
+		resources, err := RenderMany[userBundle, userResource](
+			context.Background(),
+			userParams{delay: time.Millisecond},
+			entities,
+			WithConcurrency(8),
+		)
+		require.NoError(t, err)
+		require.Len(t, resources, len(entities))
+
+		for i, entity := range entities {
+			assert.Equal(t, "usr_"+strconv.Itoa(entity.ID), resources[i].ID)
+		}
+	})
+
+	t.Run("concurrent fails fast", func(t *testing.T) {
+		userRenderCalls.Store(0)
+
+		_, err := RenderMany[userBundle, userResource](
+			context.Background(),
+			userParams{failOn: 1, delay: 10 * time.Millisecond},
+			users(100),
+			WithConcurrency(2),
+		)
+		require.ErrorIs(t, err, errRender)
+		assert.Less(t, userRenderCalls.Load(), int64(100))
+	})
+
+	t.Run("concurrent respects cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := RenderMany[userBundle, userResource](ctx, userParams{}, users(10), WithConcurrency(4))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,233 @@
+// Package apiresourcetest provides utilities for testing apiresource
+// Renderable implementations.
+//
+// A Recorder observes Bundle and Render calls made while rendering and
+// reports violations of the two-phase render contract: more than one Bundle
+// call per relation, which indicates an N+1 problem, and database queries
+// issued by Render outside of Bundle.
+//
+// The Recorder relies on apiresource.Observer, which is not notified in
+// builds with the production tag, so NewRecorder fails the test in such
+// builds rather than letting assertions pass vacuously.
+package apiresourcetest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.inout.gg/foundations/apiresource"
+)
+
+var _ apiresource.Observer = (*Recorder)(nil)
+
+// BundleCall is a recorded Bundle call.
+type BundleCall struct {
+	// Entities is the []TEntity slice passed to Bundle.
+	Entities any
+
+	// Resource is the name of the resource type.
+	Resource string
+
+	// Path identifies the relation the resource is rendered for,
+	// see apiresource.BundleInfo.Path.
+	Path string
+
+	// Level is the nesting level of the resource, 0 for top-level resources.
+	Level int
+
+	// DuringRender reports whether Bundle was called from within Render.
+	DuringRender bool
+}
+
+type frameCtxKey struct{}
+
+//nolint:gochecknoglobals
+var kFrameCtxKey = frameCtxKey{}
+
+// frame is a Bundle or Render call in progress.
+type frame struct {
+	parent *frame
+	render bool
+}
+
+// inRender reports whether f is made from within Render.
+func (f *frame) inRender() bool {
+	for c := f; c != nil; c = c.parent {
+		if c.render {
+			return true
+		}
+	}
+
+	return false
+}
+
+func frameFromContext(ctx context.Context) *frame {
+	f, _ := ctx.Value(kFrameCtxKey).(*frame)
+	return f
+}
+
+// Recorder records Bundle and Render calls and database queries.
+//
+// Use Context to attach the recorder to the context passed to apiresource
+// rendering functions, and DB to wrap the database used by Bundle and Render.
+// Queries are attributed to the Bundle or Render call by the context they
+// are made with.
+type Recorder struct {
+	t        testing.TB
+	bundles  []BundleCall
+	renderIO []string
+	renders  int
+	queries  int
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a new Recorder reporting violations to t.
+//
+// It fails the test immediately in builds with the production tag.
+func NewRecorder(t testing.TB) *Recorder {
+	t.Helper()
+
+	if !observed {
+		t.Fatal("apiresourcetest: rendering is not observed in builds with the production tag")
+	}
+
+	//nolint:exhaustruct
+	return &Recorder{t: t}
+}
+
+// Context returns a new context that reports rendering to the recorder.
+func (r *Recorder) Context(ctx context.Context) context.Context {
+	return apiresource.WithObserver(ctx, r)
+}
+
+// ObserveBundle implements apiresource.Observer.
+func (r *Recorder) ObserveBundle(ctx context.Context, info apiresource.BundleInfo) (context.Context, func()) {
+	parent := frameFromContext(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bundles = append(r.bundles, BundleCall{
+		Entities:     info.Entities,
+		Resource:     info.Resource,
+		Path:         info.Path,
+		Level:        info.Level,
+		DuringRender: parent.inRender(),
+	})
+
+	return context.WithValue(ctx, kFrameCtxKey, &frame{parent: parent, render: false}), func() {}
+}
+
+// ObserveRender implements apiresource.Observer.
+func (r *Recorder) ObserveRender(ctx context.Context, _ apiresource.RenderInfo) (context.Context, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.renders++
+
+	return context.WithValue(ctx, kFrameCtxKey, &frame{parent: frameFromContext(ctx), render: true}), func() {}
+}
+
+// BundleCalls returns the recorded Bundle calls in the order they were made.
+func (r *Recorder) BundleCalls() []BundleCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]BundleCall(nil), r.bundles...)
+}
+
+// RenderCalls returns the number of recorded Render calls.
+func (r *Recorder) RenderCalls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.renders
+}
+
+// Queries returns the number of database queries made through DB.
+func (r *Recorder) Queries() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.queries
+}
+
+// Reset forgets everything recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bundles, r.renderIO, r.renders, r.queries = nil, nil, 0, 0
+}
+
+// AssertBundledOncePerLevel reports an error if Bundle was called more than
+// once for the same relation, or was called from within Render.
+//
+// Relations are told apart by their path, so sibling relations rendering
+// the same resource type on the same level are allowed to call Bundle once
+// each.
+func (r *Recorder) AssertBundledOncePerLevel() bool {
+	r.t.Helper()
+
+	ok := true
+	seen := make(map[string][]BundleCall)
+
+	for _, call := range r.BundleCalls() {
+		if call.DuringRender {
+			ok = false
+
+			r.t.Errorf("apiresourcetest: %s.Bundle called from within Render at level %d", call.Resource, call.Level)
+		}
+
+		seen[call.Path] = append(seen[call.Path], call)
+	}
+
+	for path, calls := range seen {
+		if len(calls) > 1 {
+			ok = false
+
+			r.t.Errorf(
+				"apiresourcetest: %s.Bundle called %d times at level %d (relation %s), expected once",
+				calls[0].Resource,
+				len(calls),
+				calls[0].Level,
+				cmp.Or(path, "<root>"),
+			)
+		}
+	}
+
+	return ok
+}
+
+// AssertNoRenderIO reports an error if a database query was made through DB
+// by Render outside of Bundle.
+func (r *Recorder) AssertNoRenderIO() bool {
+	r.t.Helper()
+
+	r.mu.Lock()
+	queries := append([]string(nil), r.renderIO...)
+	r.mu.Unlock()
+
+	for _, q := range queries {
+		r.t.Errorf("apiresourcetest: query made during Render outside of Bundle: %s", q)
+	}
+
+	return len(queries) == 0
+}
+
+// recordQuery records a query and checks whether it is made by Render.
+func (r *Recorder) recordQuery(ctx context.Context, op string, sql string) {
+	f := frameFromContext(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queries++
+
+	if f != nil && f.render {
+		r.renderIO = append(r.renderIO, fmt.Sprintf("%s %q", op, sql))
+	}
+}
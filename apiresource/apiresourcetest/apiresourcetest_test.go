@@ -0,0 +1,229 @@
+//go:build !production
+
+package apiresourcetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/apiresource"
+	"go.inout.gg/foundations/dbsql"
+)
+
+// fakeT captures reported errors.
+type fakeT struct {
+	testing.TB
+
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// fakeDB is a DBTX that accepts Exec calls only.
+type fakeDB struct {
+	dbsql.DBTX
+}
+
+func (fakeDB) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("SELECT 1"), nil
+}
+
+type dbKey struct{}
+
+func dbFromContext(ctx context.Context) dbsql.DBTX {
+	db, _ := ctx.Value(dbKey{}).(dbsql.DBTX)
+	return db
+}
+
+type params struct {
+	renderIO bool
+	nested   bool
+}
+
+type author struct {
+	Name string `json:"name"`
+}
+
+func (author) Bundle(ctx context.Context, _ params, _ []string) (struct{}, error) {
+	_, err := dbFromContext(ctx).Exec(ctx, "SELECT * FROM authors")
+	return struct{}{}, err
+}
+
+func (author) Render(_ context.Context, _ params, _ struct{}, name string) (author, error) {
+	return author{Name: name}, nil
+}
+
+type post struct {
+	Author *author `json:"author"`
+	Title  string  `json:"title"`
+}
+
+func (post) Bundle(ctx context.Context, _ params, _ []string) (struct{}, error) {
+	_, err := dbFromContext(ctx).Exec(ctx, "SELECT * FROM posts")
+	return struct{}{}, err
+}
+
+func (post) Render(ctx context.Context, p params, _ struct{}, title string) (post, error) {
+	if p.renderIO {
+		if _, err := dbFromContext(ctx).Exec(ctx, "SELECT * FROM comments"); err != nil {
+			return post{}, err
+		}
+	}
+
+	if p.nested {
+		a, err := apiresource.Render[author](ctx, p, "author of "+title)
+		if err != nil {
+			return post{}, err
+		}
+
+		return post{Title: title, Author: &a}, nil
+	}
+
+	return post{Title: title, Author: nil}, nil
+}
+
+func (post) Relations() []apiresource.Relation[string, post, params] {
+	return []apiresource.Relation[string, post, params]{
+		apiresource.HasOne[struct{}, author](
+			func(title string) (string, bool) { return "author of " + title, true },
+			func(p *post, a author) {
+				if p.Author == nil {
+					p.Author = &a
+				}
+			},
+		),
+	}
+}
+
+type address struct {
+	City string `json:"city"`
+}
+
+func (address) Bundle(ctx context.Context, _ params, _ []string) (struct{}, error) {
+	_, err := dbFromContext(ctx).Exec(ctx, "SELECT * FROM addresses")
+	return struct{}{}, err
+}
+
+func (address) Render(_ context.Context, _ params, _ struct{}, city string) (address, error) {
+	return address{City: city}, nil
+}
+
+type order struct {
+	Billing  address `json:"billing"`
+	Shipping address `json:"shipping"`
+}
+
+func (order) Bundle(context.Context, params, []string) (struct{}, error) { return struct{}{}, nil }
+
+func (order) Render(context.Context, params, struct{}, string) (order, error) { return order{}, nil }
+
+func (order) Relations() []apiresource.Relation[string, order, params] {
+	return []apiresource.Relation[string, order, params]{
+		apiresource.HasOne[struct{}, address](
+			func(id string) (string, bool) { return "billing " + id, true },
+			func(o *order, a address) { o.Billing = a },
+		),
+		apiresource.HasOne[struct{}, address](
+			func(id string) (string, bool) { return "shipping " + id, true },
+			func(o *order, a address) { o.Shipping = a },
+		),
+	}
+}
+
+func render(t *testing.T, p params) (*fakeT, *Recorder) {
+	t.Helper()
+
+	ft := &fakeT{TB: t, errors: nil}
+	rec := NewRecorder(ft)
+	ctx := context.WithValue(rec.Context(context.Background()), dbKey{}, rec.DB(fakeDB{}))
+
+	_, err := apiresource.RenderMany[struct{}, post](ctx, p, []string{"a", "b", "c"}, apiresource.WithConcurrency(2))
+	require.NoError(t, err)
+
+	return ft, rec
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("two-phase render", func(t *testing.T) {
+		ft, rec := render(t, params{renderIO: false, nested: false})
+
+		assert.True(t, rec.AssertBundledOncePerLevel())
+		assert.True(t, rec.AssertNoRenderIO())
+		assert.Empty(t, ft.errors)
+		assert.Equal(t, 2, rec.Queries())
+		assert.Equal(t, 6, rec.RenderCalls())
+
+		calls := rec.BundleCalls()
+		require.Len(t, calls, 2)
+		assert.Equal(t, 0, calls[0].Level)
+		assert.Equal(t, []string{"a", "b", "c"}, calls[0].Entities)
+		assert.Equal(t, 1, calls[1].Level)
+	})
+
+	t.Run("query in render", func(t *testing.T) {
+		ft, rec := render(t, params{renderIO: true, nested: false})
+
+		assert.True(t, rec.AssertBundledOncePerLevel())
+		assert.False(t, rec.AssertNoRenderIO())
+		assert.Len(t, ft.errors, 3)
+	})
+
+	t.Run("render in render", func(t *testing.T) {
+		ft, rec := render(t, params{renderIO: false, nested: true})
+
+		assert.False(t, rec.AssertBundledOncePerLevel())
+		assert.True(t, rec.AssertNoRenderIO())
+		assert.NotEmpty(t, ft.errors)
+	})
+
+	t.Run("sibling relations of the same type", func(t *testing.T) {
+		ft := &fakeT{TB: t, errors: nil}
+		rec := NewRecorder(ft)
+		ctx := context.WithValue(rec.Context(context.Background()), dbKey{}, rec.DB(fakeDB{}))
+
+		_, err := apiresource.RenderMany[struct{}, order](ctx, params{}, []string{"1", "2"})
+		require.NoError(t, err)
+
+		assert.True(t, rec.AssertBundledOncePerLevel())
+		assert.Empty(t, ft.errors)
+
+		calls := rec.BundleCalls()
+		require.Len(t, calls, 3)
+		assert.Equal(t, "0", calls[1].Path)
+		assert.Equal(t, "1", calls[2].Path)
+	})
+
+	t.Run("query in render during another bundle", func(t *testing.T) {
+		ft := &fakeT{TB: t, errors: nil}
+		rec := NewRecorder(ft)
+		db := rec.DB(fakeDB{})
+		ctx := rec.Context(context.Background())
+
+		bundleCtx, bundleDone := rec.ObserveBundle(ctx, apiresource.BundleInfo{Resource: "author"})
+		renderCtx, renderDone := rec.ObserveRender(ctx, apiresource.RenderInfo{Resource: "post"})
+
+		_, err := db.Exec(bundleCtx, "SELECT * FROM authors")
+		require.NoError(t, err)
+		_, err = db.Exec(renderCtx, "SELECT * FROM comments")
+		require.NoError(t, err)
+
+		bundleDone()
+		renderDone()
+
+		assert.False(t, rec.AssertNoRenderIO())
+		assert.Equal(
+			t,
+			[]string{`apiresourcetest: query made during Render outside of Bundle: Exec "SELECT * FROM comments"`},
+			ft.errors,
+		)
+	})
+}
@@ -0,0 +1,72 @@
+package apiresourcetest
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go.inout.gg/foundations/dbsql"
+)
+
+var _ dbsql.DBTX = (*db)(nil)
+
+// DB wraps the database so that queries made through it are counted by
+// the recorder.
+//
+// Queries made through transactions started with Begin are not counted
+// individually, only the Begin call itself.
+func (r *Recorder) DB(d dbsql.DBTX) dbsql.DBTX {
+	return &db{db: d, rec: r}
+}
+
+type db struct {
+	db  dbsql.DBTX
+	rec *Recorder
+}
+
+//nolint:wrapcheck // transparent wrapper
+func (d *db) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	d.rec.recordQuery(ctx, "Exec", sql)
+	return d.db.Exec(ctx, sql, args...)
+}
+
+//nolint:wrapcheck // transparent wrapper
+func (d *db) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	d.rec.recordQuery(ctx, "Query", sql)
+	return d.db.Query(ctx, sql, args...)
+}
+
+func (d *db) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	d.rec.recordQuery(ctx, "QueryRow", sql)
+	return d.db.QueryRow(ctx, sql, args...)
+}
+
+//nolint:wrapcheck // transparent wrapper
+func (d *db) CopyFrom(
+	ctx context.Context,
+	table pgx.Identifier,
+	columns []string,
+	src pgx.CopyFromSource,
+) (int64, error) {
+	d.rec.recordQuery(ctx, "CopyFrom", table.Sanitize())
+	return d.db.CopyFrom(ctx, table, columns, src)
+}
+
+func (d *db) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	queries := make([]string, len(b.QueuedQueries))
+	for i, q := range b.QueuedQueries {
+		queries[i] = q.SQL
+	}
+
+	d.rec.recordQuery(ctx, "SendBatch", strings.Join(queries, "; "))
+
+	return d.db.SendBatch(ctx, b)
+}
+
+//nolint:wrapcheck // transparent wrapper
+func (d *db) Begin(ctx context.Context) (pgx.Tx, error) {
+	d.rec.recordQuery(ctx, "Begin", "BEGIN")
+	return d.db.Begin(ctx)
+}
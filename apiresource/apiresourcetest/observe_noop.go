@@ -0,0 +1,6 @@
+//go:build production
+
+package apiresourcetest
+
+// observed reports whether apiresource notifies observers.
+const observed = false
@@ -0,0 +1,205 @@
+package apiresource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.inout.gg/foundations/http/httperror"
+)
+
+const (
+	// DefaultExpandMaxDepth is the default maximum depth of an expand path.
+	DefaultExpandMaxDepth = 4
+)
+
+var (
+	ErrUnknownExpandPath = errors.New("apiresource: unknown expand path")
+	ErrExpandTooDeep     = errors.New("apiresource: expand path is too deep")
+	ErrMalformedExpand   = errors.New("apiresource: malformed expand path")
+)
+
+// Expandable is a field that is rendered as an ID by default and as
+// the full resource once it is expanded.
+type Expandable[TID any, TResource any] struct {
+	Resource *TResource
+	ID       TID
+}
+
+// IsExpanded reports whether the resource has been expanded.
+func (e Expandable[TID, TResource]) IsExpanded() bool { return e.Resource != nil }
+
+// Expand sets the expanded resource.
+func (e *Expandable[TID, TResource]) Expand(resource TResource) { e.Resource = &resource }
+
+// MarshalJSON encodes the expanded resource, or the ID if the resource is not expanded.
+func (e Expandable[TID, TResource]) MarshalJSON() ([]byte, error) {
+	if e.Resource != nil {
+		return json.Marshal(e.Resource) //nolint:wrapcheck // encoding/json wraps errors
+	}
+
+	return json.Marshal(e.ID) //nolint:wrapcheck // encoding/json wraps errors
+}
+
+// Expand is a set of expand paths requested by the client, such as
+// "customer" or "customer.default_source".
+//
+// The zero value is an empty set.
+type Expand struct {
+	paths pathTree
+}
+
+// ExpandOptions is used to configure ParseExpand.
+type ExpandOptions struct {
+	// Allowed is the list of paths that can be expanded.
+	//
+	// Every prefix of an allowed path is allowed as well. If Allowed is nil,
+	// any path is accepted.
+	Allowed []string
+
+	// MaxDepth is the maximum number of segments in an expand path.
+	//
+	// Defaults to DefaultExpandMaxDepth.
+	MaxDepth int
+}
+
+// ParseExpand parses the given expand paths.
+//
+// Paths that are malformed, too deep or unknown are rejected with
+// an httperror.HTTPError with http.StatusBadRequest status.
+func ParseExpand(paths []string, opts *ExpandOptions) (Expand, error) {
+	maxDepth := DefaultExpandMaxDepth
+
+	var allowed pathTree
+	if opts != nil {
+		if opts.MaxDepth > 0 {
+			maxDepth = opts.MaxDepth
+		}
+
+		if opts.Allowed != nil {
+			allowed = make(pathTree)
+			for _, p := range opts.Allowed {
+				allowed.add(splitPath(p))
+			}
+		}
+	}
+
+	expand := Expand{paths: make(pathTree)}
+
+	for _, p := range paths {
+		segments := splitPath(p)
+		if slices.Contains(segments, "") {
+			return Expand{}, httperror.New(
+				fmt.Sprintf("malformed expand path %q", p),
+				http.StatusBadRequest,
+				ErrMalformedExpand,
+			)
+		}
+
+		if len(segments) > maxDepth {
+			return Expand{}, httperror.New(
+				fmt.Sprintf("expand path %q exceeds maximum depth of %d", p, maxDepth),
+				http.StatusBadRequest,
+				ErrExpandTooDeep,
+			)
+		}
+
+		if allowed != nil && !allowed.contains(segments) {
+			return Expand{}, httperror.New(
+				fmt.Sprintf("unknown expand path %q", p),
+				http.StatusBadRequest,
+				ErrUnknownExpandPath,
+			)
+		}
+
+		expand.paths.add(segments)
+	}
+
+	return expand, nil
+}
+
+// ExpandFromRequest parses expand paths from the "expand[]" and "expand"
+// query parameters of the request r.
+//
+// Values may contain multiple comma-separated paths.
+func ExpandFromRequest(r *http.Request, opts *ExpandOptions) (Expand, error) {
+	query := r.URL.Query()
+
+	var paths []string
+	for _, key := range []string{"expand[]", "expand"} {
+		for _, v := range query[key] {
+			paths = append(paths, strings.Split(v, ",")...)
+		}
+	}
+
+	return ParseExpand(paths, opts)
+}
+
+// Has reports whether the field is expanded.
+func (e Expand) Has(field string) bool {
+	_, ok := e.paths[field]
+	return ok
+}
+
+// Sub returns the expand set nested under the field.
+func (e Expand) Sub(field string) Expand { return Expand{paths: e.paths[field]} }
+
+// IsEmpty reports whether nothing is expanded.
+func (e Expand) IsEmpty() bool { return len(e.paths) == 0 }
+
+// Paths returns all expand paths in the set in lexicographical order.
+func (e Expand) Paths() []string { return e.paths.paths() }
+
+// Scoper is implemented by params that carry per-field state, such as
+// an expand set, and need to be narrowed down when rendering a nested field.
+type Scoper[TParams any] interface {
+	// Scope returns params for rendering the nested field.
+	Scope(field string) TParams
+}
+
+// ExpandParams is implemented by params that carry an expand set.
+type ExpandParams[TParams any] interface {
+	Scoper[TParams]
+
+	// Expansions returns the expand set for the current level.
+	Expansions() Expand
+}
+
+// Expansion declares that the relation rel renders the expandable field.
+//
+// The relation is resolved only if the field is expanded, in which case it
+// is rendered with params scoped to the field, so neither Bundle nor Render
+// of the related resource is called unless the client asked for it.
+//
+// If params implement FieldsParams, the relation is also skipped when
+// the field is not selected.
+func Expansion[TEntity any, TResource any, TParams ExpandParams[TParams]](
+	field string,
+	rel Relation[TEntity, TResource, TParams],
+) Relation[TEntity, TResource, TParams] {
+	return &expansion[TEntity, TResource, TParams]{field: field, rel: rel}
+}
+
+type expansion[TEntity any, TResource any, TParams ExpandParams[TParams]] struct {
+	rel   Relation[TEntity, TResource, TParams]
+	field string
+}
+
+func (r *expansion[TEntity, TResource, TParams]) resolve(
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	resources []TResource,
+	errs []error,
+	options RenderOptions,
+) error {
+	if !params.Expansions().Has(r.field) || !isSelected(params, r.field) {
+		return nil
+	}
+
+	return r.rel.resolve(ctx, params.Scope(r.field), entities, resources, errs, options)
+}
@@ -0,0 +1,178 @@
+package apiresource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/http/httperror"
+)
+
+type chargeParams struct {
+	expand Expand
+}
+
+func (p chargeParams) Expansions() Expand { return p.expand }
+
+func (p chargeParams) Scope(field string) chargeParams {
+	return chargeParams{expand: p.expand.Sub(field)}
+}
+
+type chargeEntity struct {
+	ID         string
+	CustomerID string
+}
+
+type chargeResource struct {
+	Customer Expandable[string, customerResource] `json:"customer"`
+	ID       string                               `json:"id"`
+}
+
+func (chargeResource) Bundle(context.Context, chargeParams, []chargeEntity) (struct{}, error) {
+	return struct{}{}, nil
+}
+
+func (chargeResource) Render(_ context.Context, _ chargeParams, _ struct{}, e chargeEntity) (chargeResource, error) {
+	return chargeResource{ID: e.ID, Customer: Expandable[string, customerResource]{ID: e.CustomerID}}, nil
+}
+
+func (chargeResource) Relations() []Relation[chargeEntity, chargeResource, chargeParams] {
+	return []Relation[chargeEntity, chargeResource, chargeParams]{
+		Expansion("customer", HasOne[struct{}, customerResource](
+			func(e chargeEntity) (string, bool) { return e.CustomerID, true },
+			func(r *chargeResource, c customerResource) { r.Customer.Expand(c) },
+		)),
+	}
+}
+
+type customerResource struct {
+	DefaultSource Expandable[string, sourceResource] `json:"default_source"` //nolint:tagliatelle // test
+	ID            string                             `json:"id"`
+}
+
+func (customerResource) Bundle(ctx context.Context, _ chargeParams, ids []string) (struct{}, error) {
+	recordBundle(ctx, "customer", len(ids))
+	return struct{}{}, nil
+}
+
+func (customerResource) Render(_ context.Context, _ chargeParams, _ struct{}, id string) (customerResource, error) {
+	return customerResource{ID: id, DefaultSource: Expandable[string, sourceResource]{ID: "src_" + id}}, nil
+}
+
+func (customerResource) Relations() []Relation[string, customerResource, chargeParams] {
+	return []Relation[string, customerResource, chargeParams]{
+		Expansion("default_source", HasOne[struct{}, sourceResource](
+			func(id string) (string, bool) { return "src_" + id, true },
+			func(r *customerResource, s sourceResource) { r.DefaultSource.Expand(s) },
+		)),
+	}
+}
+
+type sourceResource struct {
+	ID string `json:"id"`
+}
+
+func (sourceResource) Bundle(ctx context.Context, _ chargeParams, ids []string) (struct{}, error) {
+	recordBundle(ctx, "source", len(ids))
+	return struct{}{}, nil
+}
+
+func (sourceResource) Render(_ context.Context, _ chargeParams, _ struct{}, id string) (sourceResource, error) {
+	return sourceResource{ID: id}, nil
+}
+
+func TestParseExpand(t *testing.T) {
+	opts := &ExpandOptions{Allowed: []string{"customer.default_source", "invoice"}, MaxDepth: 2}
+
+	t.Run("it works", func(t *testing.T) {
+		expand, err := ParseExpand([]string{"customer.default_source", "invoice", "customer"}, opts)
+		require.NoError(t, err)
+
+		assert.True(t, expand.Has("customer"))
+		assert.True(t, expand.Sub("customer").Has("default_source"))
+		assert.True(t, expand.Has("invoice"))
+		assert.False(t, expand.Has("default_source"))
+		assert.Equal(t, []string{"customer.default_source", "invoice"}, expand.Paths())
+	})
+
+	tests := []struct {
+		want  error
+		name  string
+		paths []string
+	}{
+		{name: "unknown path", paths: []string{"customer.unknown"}, want: ErrUnknownExpandPath},
+		{name: "too deep", paths: []string{"customer.default_source.owner"}, want: ErrExpandTooDeep},
+		{name: "malformed", paths: []string{"customer."}, want: ErrMalformedExpand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExpand(tt.paths, opts)
+			require.ErrorIs(t, err, tt.want)
+
+			var herr httperror.HTTPError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, http.StatusBadRequest, herr.StatusCode())
+		})
+	}
+}
+
+func TestExpandFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?expand[]=customer&expand[]=invoice&expand=charge,refund", nil)
+
+	expand, err := ExpandFromRequest(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"charge", "customer", "invoice", "refund"}, expand.Paths())
+}
+
+func TestExpansion(t *testing.T) {
+	charges := []chargeEntity{{ID: "ch_1", CustomerID: "cus_1"}, {ID: "ch_2", CustomerID: "cus_2"}}
+
+	tests := []struct {
+		bundles map[string][]int
+		name    string
+		want    string
+		expand  []string
+	}{
+		{
+			name:    "not expanded",
+			expand:  nil,
+			want:    `{"customer":"cus_1","id":"ch_1"}`,
+			bundles: map[string][]int{},
+		},
+		{
+			name:    "expanded",
+			expand:  []string{"customer"},
+			want:    `{"customer":{"default_source":"src_cus_1","id":"cus_1"},"id":"ch_1"}`,
+			bundles: map[string][]int{"customer": {2}},
+		},
+		{
+			name:    "expanded nested",
+			expand:  []string{"customer.default_source"},
+			want:    `{"customer":{"default_source":{"id":"src_cus_1"},"id":"cus_1"},"id":"ch_1"}`,
+			bundles: map[string][]int{"customer": {2}, "source": {2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, log := withBundleLog(context.Background())
+
+			expand, err := ParseExpand(tt.expand, nil)
+			require.NoError(t, err)
+
+			resources, err := RenderMany[struct{}, chargeResource](ctx, chargeParams{expand: expand}, charges)
+			require.NoError(t, err)
+
+			got, err := json.Marshal(resources[0])
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.Equal(t, tt.bundles, log.calls)
+		})
+	}
+}
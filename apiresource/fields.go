@@ -0,0 +1,385 @@
+package apiresource
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.inout.gg/foundations/http/httperror"
+)
+
+var (
+	ErrUnknownField    = errors.New("apiresource: unknown field")
+	ErrMalformedFields = errors.New("apiresource: malformed fields")
+)
+
+// Fields is a selection of resource fields requested by the client,
+// such as "id,name,customer.email". Fields are matched by their JSON name.
+//
+// The zero value selects all fields.
+type Fields struct {
+	paths pathTree
+}
+
+// ParseFields parses a comma-separated list of field paths.
+//
+// Malformed paths are rejected with an httperror.HTTPError with
+// http.StatusBadRequest status.
+func ParseFields(s string) (Fields, error) {
+	fields := Fields{paths: nil}
+
+	for p := range strings.SplitSeq(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		segments := splitPath(p)
+		if slices.Contains(segments, "") {
+			return Fields{}, httperror.New(
+				fmt.Sprintf("malformed field %q", p),
+				http.StatusBadRequest,
+				ErrMalformedFields,
+			)
+		}
+
+		if fields.paths == nil {
+			fields.paths = make(pathTree)
+		}
+
+		fields.paths.add(segments)
+	}
+
+	return fields, nil
+}
+
+// FieldsFromRequest parses the "fields" query parameter of the request r.
+func FieldsFromRequest(r *http.Request) (Fields, error) {
+	return ParseFields(strings.Join(r.URL.Query()["fields"], ","))
+}
+
+// Has reports whether the field is selected.
+func (f Fields) Has(field string) bool {
+	if f.IsAll() {
+		return true
+	}
+
+	_, ok := f.paths[field]
+
+	return ok
+}
+
+// Sub returns the selection nested under the field.
+//
+// If the field is selected as a whole, all of its nested fields are selected.
+func (f Fields) Sub(field string) Fields { return Fields{paths: f.paths[field]} }
+
+// IsAll reports whether all fields are selected.
+func (f Fields) IsAll() bool { return len(f.paths) == 0 }
+
+// Paths returns all selected field paths in lexicographical order.
+func (f Fields) Paths() []string { return f.paths.paths() }
+
+// ValidateFields checks that every selected field exists in TResource.
+//
+// Unknown fields are rejected with an httperror.HTTPError with
+// http.StatusBadRequest status.
+func ValidateFields[TResource any](fields Fields) error {
+	return validateFields(reflect.TypeFor[TResource](), fields.paths, "")
+}
+
+// Select applies the field selection to the JSON representation of resource.
+//
+// The order of the remaining fields is preserved.
+func Select[TResource any](fields Fields, resource TResource) (json.RawMessage, error) {
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil, fmt.Errorf("apiresource: failed to encode resource: %w", err)
+	}
+
+	if fields.IsAll() {
+		return b, nil
+	}
+
+	return selectJSON(b, fields.paths)
+}
+
+// SelectMany is similar to Select, but applies the selection to many resources.
+func SelectMany[TResource any](fields Fields, resources []TResource) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, len(resources))
+
+	for i, r := range resources {
+		b, err := Select(fields, r)
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = b
+	}
+
+	return result, nil
+}
+
+// FieldsParams is implemented by params that carry a field selection.
+type FieldsParams[TParams any] interface {
+	Scoper[TParams]
+
+	// Selection returns the field selection for the current level.
+	Selection() Fields
+}
+
+// Selected declares that the relation rel renders the field.
+//
+// The relation is resolved only if the field is selected, in which case it
+// is rendered with params scoped to the field.
+func Selected[TEntity any, TResource any, TParams FieldsParams[TParams]](
+	field string,
+	rel Relation[TEntity, TResource, TParams],
+) Relation[TEntity, TResource, TParams] {
+	return &selected[TEntity, TResource, TParams]{field: field, rel: rel}
+}
+
+type selected[TEntity any, TResource any, TParams FieldsParams[TParams]] struct {
+	rel   Relation[TEntity, TResource, TParams]
+	field string
+}
+
+func (r *selected[TEntity, TResource, TParams]) resolve(
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	resources []TResource,
+	errs []error,
+	options RenderOptions,
+) error {
+	if !params.Selection().Has(r.field) {
+		return nil
+	}
+
+	return r.rel.resolve(ctx, params.Scope(r.field), entities, resources, errs, options)
+}
+
+// isSelected reports whether the field is selected if params carry a field
+// selection, otherwise it reports true.
+func isSelected(params any, field string) bool {
+	if p, ok := params.(interface{ Selection() Fields }); ok {
+		return p.Selection().Has(field)
+	}
+
+	return true
+}
+
+// selectJSON removes the unselected fields from the JSON value b.
+func selectJSON(b []byte, paths pathTree) (json.RawMessage, error) {
+	b = bytes.TrimSpace(b)
+	if len(paths) == 0 || len(b) == 0 {
+		return b, nil
+	}
+
+	switch b[0] {
+	case '{':
+		return selectObject(b, paths)
+	case '[':
+		return selectArray(b, paths)
+	default:
+		// Scalars, such as IDs of unexpanded fields, have no fields to select.
+		return b, nil
+	}
+}
+
+func selectObject(b []byte, paths pathTree) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("apiresource: failed to decode resource: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("apiresource: failed to decode resource: %w", err)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("apiresource: failed to decode resource: %w", err)
+		}
+
+		key, _ := tok.(string)
+
+		sub, ok := paths[key]
+		if !ok {
+			continue
+		}
+
+		value, err = selectJSON(value, sub)
+		if err != nil {
+			return nil, err
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func selectArray(b []byte, paths pathTree) (json.RawMessage, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("apiresource: failed to decode resource: %w", err)
+	}
+
+	for i, v := range values {
+		selected, err := selectJSON(v, paths)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = selected
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("apiresource: failed to encode resource: %w", err)
+	}
+
+	return b, nil
+}
+
+// expandable is implemented by Expandable to expose the type of the expanded resource.
+type expandable interface {
+	expandedType() reflect.Type
+}
+
+func (Expandable[TID, TResource]) expandedType() reflect.Type { return reflect.TypeFor[TResource]() }
+
+//nolint:gochecknoglobals
+var (
+	expandableType    = reflect.TypeFor[expandable]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// validateFields checks paths against the JSON fields of the type t.
+func validateFields(t reflect.Type, paths pathTree, prefix string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	t = indirectType(t)
+
+	if t.Implements(expandableType) {
+		//nolint:forcetypeassert // checked above
+		return validateFields(reflect.Zero(t).Interface().(expandable).expandedType(), paths, prefix)
+	}
+
+	switch {
+	case t.Kind() == reflect.Map:
+		// Map keys are dynamic and cannot be validated.
+		return nil
+	case t.Implements(jsonMarshalerType), t.Implements(textMarshalerType), t.Kind() != reflect.Struct:
+		return unknownFieldError(prefix + paths.paths()[0])
+	}
+
+	fields := jsonFields(t)
+
+	for name, sub := range paths {
+		ft, ok := fields[name]
+		if !ok {
+			return unknownFieldError(prefix + name)
+		}
+
+		if err := validateFields(ft, sub, prefix+name+pathSeparator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unknownFieldError(path string) error {
+	return httperror.New(fmt.Sprintf("unknown field %q", path), http.StatusBadRequest, ErrUnknownField)
+}
+
+// indirectType dereferences pointers and element types of slices and arrays.
+func indirectType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() { //nolint:exhaustive // only containers are unwrapped
+		case reflect.Pointer:
+			t = t.Elem()
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				return t
+			}
+
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// jsonFields returns the JSON fields of the struct type t following
+// encoding/json naming rules, including fields promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+
+	for i := range t.NumField() {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				for n, f := range jsonFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = f
+					}
+				}
+
+				continue
+			}
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields[name] = sf.Type
+	}
+
+	return fields
+}
@@ -0,0 +1,245 @@
+package apiresource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/http/httperror"
+)
+
+type accountAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+type accountMeta struct {
+	Plan string `json:"plan"`
+}
+
+type accountResource struct {
+	accountMeta
+
+	CreatedAt time.Time                            `json:"created_at"` //nolint:tagliatelle // test
+	Address   *accountAddress                      `json:"address"`
+	Owner     Expandable[string, customerResource] `json:"owner"`
+	ID        string                               `json:"id"`
+	Name      string                               `json:"name"`
+	Tags      []accountAddress                     `json:"tags"`
+	Internal  string                               `json:"-"`
+}
+
+func TestParseFields(t *testing.T) {
+	t.Run("it works", func(t *testing.T) {
+		fields, err := ParseFields("id, name,address.city,,")
+		require.NoError(t, err)
+
+		assert.True(t, fields.Has("id"))
+		assert.True(t, fields.Has("address"))
+		assert.False(t, fields.Has("status"))
+		assert.True(t, fields.Sub("address").Has("city"))
+		assert.False(t, fields.Sub("address").Has("country"))
+		assert.True(t, fields.Sub("id").IsAll())
+		assert.Equal(t, []string{"address.city", "id", "name"}, fields.Paths())
+	})
+
+	t.Run("empty selects all", func(t *testing.T) {
+		fields, err := ParseFields("")
+		require.NoError(t, err)
+		assert.True(t, fields.IsAll())
+		assert.True(t, fields.Has("anything"))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := ParseFields("address.")
+		require.ErrorIs(t, err, ErrMalformedFields)
+	})
+
+	t.Run("from request", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/?fields=id,name&fields=status", nil)
+
+		fields, err := FieldsFromRequest(r)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "name", "status"}, fields.Paths())
+	})
+}
+
+func TestValidateFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  string
+		wantErr bool
+	}{
+		{name: "top level", fields: "id,name,created_at", wantErr: false},
+		{name: "nested pointer", fields: "address.city", wantErr: false},
+		{name: "nested slice", fields: "tags.country", wantErr: false},
+		{name: "embedded", fields: "plan", wantErr: false},
+		{name: "expandable", fields: "owner.default_source.id", wantErr: false},
+		{name: "unknown", fields: "status", wantErr: true},
+		{name: "unknown nested", fields: "address.street", wantErr: true},
+		{name: "ignored field", fields: "Internal", wantErr: true},
+		{name: "nested in scalar", fields: "id.value", wantErr: true},
+		{name: "nested in marshaler", fields: "created_at.unix", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := ParseFields(tt.fields)
+			require.NoError(t, err)
+
+			err = ValidateFields[accountResource](fields)
+			if !tt.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrUnknownField)
+
+			var herr httperror.HTTPError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, http.StatusBadRequest, herr.StatusCode())
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	resource := accountResource{
+		accountMeta: accountMeta{Plan: "pro"},
+		ID:          "acct_1",
+		Name:        "Acme",
+		Address:     &accountAddress{City: "Berlin", Country: "DE"},
+		Tags:        []accountAddress{{City: "Paris", Country: "FR"}},
+		Owner:       Expandable[string, customerResource]{ID: "cus_1"},
+	}
+
+	tests := []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{name: "all", fields: "", want: ""},
+		{name: "subset keeps order", fields: "name,id", want: `{"id":"acct_1","name":"Acme"}`},
+		{name: "nested", fields: "address.city", want: `{"address":{"city":"Berlin"}}`},
+		{name: "nested slice", fields: "tags.country", want: `{"tags":[{"country":"FR"}]}`},
+		{name: "unexpanded", fields: "owner.id", want: `{"owner":"cus_1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := ParseFields(tt.fields)
+			require.NoError(t, err)
+
+			got, err := Select(fields, resource)
+			require.NoError(t, err)
+
+			if tt.want == "" {
+				assert.Contains(t, string(got), `"plan":"pro"`)
+				return
+			}
+
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+type selectionParams struct {
+	fields Fields
+	expand Expand
+}
+
+func (p selectionParams) Selection() Fields  { return p.fields }
+func (p selectionParams) Expansions() Expand { return p.expand }
+
+func (p selectionParams) Scope(field string) selectionParams {
+	return selectionParams{fields: p.fields.Sub(field), expand: p.expand.Sub(field)}
+}
+
+type invoiceResource struct {
+	Lines []lineResource                    `json:"lines"`
+	Payer Expandable[string, payerResource] `json:"payer"`
+	ID    string                            `json:"id"`
+}
+
+func (invoiceResource) Bundle(context.Context, selectionParams, []string) (struct{}, error) {
+	return struct{}{}, nil
+}
+
+func (invoiceResource) Render(_ context.Context, _ selectionParams, _ struct{}, id string) (invoiceResource, error) {
+	return invoiceResource{ID: id, Payer: Expandable[string, payerResource]{ID: "payer_" + id}}, nil
+}
+
+func (invoiceResource) Relations() []Relation[string, invoiceResource, selectionParams] {
+	return []Relation[string, invoiceResource, selectionParams]{
+		Selected("lines", HasMany[struct{}, lineResource](
+			func(id string) []string { return []string{id + "_1", id + "_2"} },
+			func(r *invoiceResource, lines []lineResource) { r.Lines = lines },
+		)),
+		Expansion("payer", HasOne[struct{}, payerResource](
+			func(id string) (string, bool) { return "payer_" + id, true },
+			func(r *invoiceResource, p payerResource) { r.Payer.Expand(p) },
+		)),
+	}
+}
+
+type lineResource struct {
+	ID string `json:"id"`
+}
+
+func (lineResource) Bundle(ctx context.Context, _ selectionParams, ids []string) (struct{}, error) {
+	recordBundle(ctx, "line", len(ids))
+	return struct{}{}, nil
+}
+
+func (lineResource) Render(_ context.Context, _ selectionParams, _ struct{}, id string) (lineResource, error) {
+	return lineResource{ID: id}, nil
+}
+
+type payerResource struct {
+	ID string `json:"id"`
+}
+
+func (payerResource) Bundle(ctx context.Context, _ selectionParams, ids []string) (struct{}, error) {
+	recordBundle(ctx, "payer", len(ids))
+	return struct{}{}, nil
+}
+
+func (payerResource) Render(_ context.Context, _ selectionParams, _ struct{}, id string) (payerResource, error) {
+	return payerResource{ID: id}, nil
+}
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		bundles map[string][]int
+		name    string
+		fields  string
+	}{
+		{name: "all fields", fields: "", bundles: map[string][]int{"line": {4}, "payer": {2}}},
+		{name: "lines only", fields: "id,lines.id", bundles: map[string][]int{"line": {4}}},
+		{name: "nothing nested", fields: "id", bundles: map[string][]int{}},
+	}
+
+	expand, err := ParseExpand([]string{"payer"}, nil)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, log := withBundleLog(context.Background())
+
+			fields, err := ParseFields(tt.fields)
+			require.NoError(t, err)
+
+			_, err = RenderMany[struct{}, invoiceResource](
+				ctx,
+				selectionParams{fields: fields, expand: expand},
+				[]string{"in_1", "in_2"},
+			)
+			require.NoError(t, err)
+			assert.Equal(t, tt.bundles, log.calls)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package apiresource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/http/httpmiddleware"
+)
+
+// DefaultLoaderTimeout is the default timeout of a fetch.
+const DefaultLoaderTimeout = 30 * time.Second
+
+type loadersCtxKey struct{}
+
+var kLoadersCtxKey = loadersCtxKey{} //nolint:gochecknoglobals
+
+// BatchFunc loads values for the given keys.
+//
+// Keys missing from the returned map are considered not found.
+type BatchFunc[K comparable, V any] func(context.Context, []K) (map[K]V, error)
+
+// LoaderConfig configures a Loader.
+type LoaderConfig struct {
+	// Timeout is the timeout of a fetch, defaults to DefaultLoaderTimeout.
+	Timeout time.Duration
+}
+
+func (c *LoaderConfig) defaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultLoaderTimeout
+	}
+}
+
+// WithLoaderTimeout sets the timeout of a fetch.
+func WithLoaderTimeout(d time.Duration) func(*LoaderConfig) {
+	return func(c *LoaderConfig) { c.Timeout = d }
+}
+
+// Loader batches, deduplicates and caches key lookups.
+//
+// It is intended to be used in Bundle implementations, so that several
+// Render calls within the same request share loaded data. Use LoaderFromContext
+// to obtain a request-scoped Loader.
+//
+// Loader is safe for concurrent use, concurrent lookups of the same key
+// result in a single fetch. The fetch is shared, so it is not cancelled
+// with the context of the lookup that started it, and is bounded by
+// LoaderConfig.Timeout instead.
+type Loader[K comparable, V any] struct {
+	fetch   BatchFunc[K, V]
+	config  *LoaderConfig
+	entries map[K]*loaderEntry[V]
+	mu      sync.Mutex
+}
+
+type loaderEntry[V any] struct {
+	value V
+	err   error
+	done  chan struct{}
+	found bool
+}
+
+// NewLoader creates a new Loader fetching values with fetch.
+func NewLoader[K comparable, V any](fetch BatchFunc[K, V], opts ...func(*LoaderConfig)) *Loader[K, V] {
+	debug.Assert(fetch != nil, "expected fetch to be defined")
+
+	//nolint:exhaustruct
+	config := &LoaderConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	config.defaults()
+
+	return &Loader[K, V]{
+		fetch:   fetch,
+		config:  config,
+		entries: make(map[K]*loaderEntry[V]),
+		mu:      sync.Mutex{},
+	}
+}
+
+// Load returns the value for the key, it reports false if the value is not found.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, bool, error) {
+	values, err := l.LoadMany(ctx, []K{key})
+	if err != nil {
+		var v V
+		return v, false, err
+	}
+
+	v, ok := values[key]
+
+	return v, ok, nil
+}
+
+// LoadMany returns values for the keys.
+//
+// Only keys that have not been loaded before are fetched, all of them with
+// a single call. Keys that are not found are omitted from the result.
+// Failed lookups are not cached.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	var (
+		missing []K
+		entries = make(map[K]*loaderEntry[V], len(keys))
+	)
+
+	l.mu.Lock()
+
+	for _, k := range keys {
+		if _, ok := entries[k]; ok {
+			continue
+		}
+
+		e, ok := l.entries[k]
+		if !ok {
+			//nolint:exhaustruct
+			e = &loaderEntry[V]{done: make(chan struct{})}
+			l.entries[k] = e
+			missing = append(missing, k)
+		}
+
+		entries[k] = e
+	}
+
+	l.mu.Unlock()
+
+	if len(missing) > 0 {
+		select {
+		case p := <-l.load(ctx, missing):
+			if p != nil {
+				panic(p)
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("apiresource: loading cancelled: %w", ctx.Err())
+		}
+	}
+
+	values := make(map[K]V, len(entries))
+
+	for k, e := range entries {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("apiresource: loading cancelled: %w", ctx.Err())
+		}
+
+		if e.err != nil {
+			return nil, e.err
+		}
+
+		if e.found {
+			values[k] = e.value
+		}
+	}
+
+	return values, nil
+}
+
+// Prime stores the value for the key unless it is already loaded.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.entries[key]; ok {
+		return
+	}
+
+	done := make(chan struct{})
+	close(done)
+
+	l.entries[key] = &loaderEntry[V]{value: value, err: nil, done: done, found: true}
+}
+
+// load fetches values for keys in the background and completes their
+// entries. The fetch keeps the values of ctx, but not its cancellation.
+//
+// The returned channel receives the value fetch panicked with, or nil, once
+// the entries are completed. If fetch panics, the entries are completed with
+// an error, so concurrent lookups of the keys do not block forever.
+func (l *Loader[K, V]) load(ctx context.Context, keys []K) <-chan any {
+	panicked := make(chan any, 1)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.config.Timeout)
+		defer cancel()
+
+		defer func() {
+			p := recover()
+			if p != nil {
+				l.complete(keys, nil, fmt.Errorf("apiresource: failed to load values: fetch panicked: %v", p))
+			}
+
+			panicked <- p
+		}()
+
+		values, err := l.fetch(ctx, keys)
+		if err != nil {
+			err = fmt.Errorf("apiresource: failed to load values: %w", err)
+		}
+
+		l.complete(keys, values, err)
+	}()
+
+	return panicked
+}
+
+// complete stores the loaded values in the entries of keys and wakes up
+// lookups waiting for them. Failed entries are forgotten.
+func (l *Loader[K, V]) complete(keys []K, values map[K]V, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, k := range keys {
+		e := l.entries[k]
+		e.value, e.found = values[k]
+		e.err = err
+
+		if err != nil {
+			delete(l.entries, k)
+		}
+
+		close(e.done)
+	}
+}
+
+// loaders is a request-scoped registry of loaders.
+type loaders struct {
+	m  map[any]any
+	mu sync.Mutex
+}
+
+// WithLoaders returns a new context with a fresh registry of loaders.
+//
+// Loaders obtained with LoaderFromContext are shared by everything using
+// the returned context.
+func WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, kLoadersCtxKey, &loaders{m: make(map[any]any), mu: sync.Mutex{}})
+}
+
+// LoaderFromContext returns the Loader registered under key in the context,
+// creating it with fetch and opts on first use.
+//
+// The key must be comparable, and should be of an unexported type to avoid
+// collisions. If the context has no loaders registry, a new Loader is
+// returned on every call, which means lookups are not cached across calls.
+func LoaderFromContext[K comparable, V any](
+	ctx context.Context,
+	key any,
+	fetch BatchFunc[K, V],
+	opts ...func(*LoaderConfig),
+) *Loader[K, V] {
+	reg, ok := ctx.Value(kLoadersCtxKey).(*loaders)
+	if !ok {
+		return NewLoader(fetch, opts...)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if l, ok := reg.m[key]; ok {
+		loader, ok := l.(*Loader[K, V])
+		debug.Assert(ok, "loader %v is registered with a different type %T", key, l)
+
+		return loader
+	}
+
+	loader := NewLoader(fetch, opts...)
+	reg.m[key] = loader
+
+	return loader
+}
+
+// LoaderMiddleware returns a middleware that installs a fresh registry of
+// loaders into the context of each request.
+func LoaderMiddleware() httpmiddleware.MiddlewareFunc {
+	return httpmiddleware.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithLoaders(r.Context())))
+		})
+	})
+}
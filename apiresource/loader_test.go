@@ -0,0 +1,206 @@
+package apiresource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namesLoaderKey struct{}
+
+type fetchLog struct {
+	calls [][]int
+	mu    sync.Mutex
+}
+
+func (l *fetchLog) fetch(_ context.Context, keys []int) (map[int]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+	l.calls = append(l.calls, sorted)
+
+	names := make(map[int]string, len(keys))
+	for _, k := range keys {
+		if k > 0 {
+			names[k] = "name"
+		}
+	}
+
+	return names, nil
+}
+
+func TestLoader(t *testing.T) {
+	t.Run("it batches, deduplicates and caches", func(t *testing.T) {
+		var log fetchLog
+
+		loader := NewLoader(log.fetch)
+
+		values, err := loader.LoadMany(context.Background(), []int{1, 2, 2, -1})
+		require.NoError(t, err)
+		assert.Equal(t, map[int]string{1: "name", 2: "name"}, values)
+
+		values, err = loader.LoadMany(context.Background(), []int{2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, map[int]string{2: "name", 3: "name"}, values)
+
+		_, ok, err := loader.Load(context.Background(), -1)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.Equal(t, [][]int{{-1, 1, 2}, {3}}, log.calls)
+	})
+
+	t.Run("it does not cache failures", func(t *testing.T) {
+		var calls atomic.Int64
+
+		errFetch := errors.New("fetch failed")
+		loader := NewLoader(func(_ context.Context, keys []int) (map[int]string, error) {
+			if calls.Add(1) == 1 {
+				return nil, errFetch
+			}
+
+			return map[int]string{keys[0]: "name"}, nil
+		})
+
+		_, _, err := loader.Load(context.Background(), 1)
+		require.ErrorIs(t, err, errFetch)
+
+		v, ok, err := loader.Load(context.Background(), 1)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "name", v)
+	})
+
+	t.Run("it unblocks concurrent lookups when fetch panics", func(t *testing.T) {
+		var calls atomic.Int64
+
+		started, release := make(chan struct{}), make(chan struct{})
+		loader := NewLoader(func(_ context.Context, keys []int) (map[int]string, error) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-release
+				panic("boom")
+			}
+
+			return map[int]string{keys[0]: "name"}, nil
+		})
+
+		panicked := make(chan any, 1)
+
+		go func() {
+			defer func() { panicked <- recover() }()
+
+			_, _, _ = loader.Load(context.Background(), 1)
+		}()
+
+		<-started
+
+		waiter := make(chan error, 1)
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, _, err := loader.Load(ctx, 1)
+			waiter <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		assert.Equal(t, "boom", <-panicked)
+
+		// The waiter either observed the panic or loaded the key again.
+		if err := <-waiter; err != nil {
+			require.ErrorContains(t, err, "fetch panicked: boom")
+		}
+
+		v, ok, err := loader.Load(context.Background(), 1)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "name", v)
+	})
+
+	t.Run("it keeps fetching for other lookups when the first one is cancelled", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		loader := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+			close(started)
+			<-release
+
+			return map[int]string{keys[0]: "name"}, ctx.Err()
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+
+		go func() {
+			_, _, err := loader.Load(ctx, 1)
+			first <- err
+		}()
+
+		<-started
+
+		waiter := make(chan error, 1)
+
+		go func() {
+			_, _, err := loader.Load(context.Background(), 1)
+			waiter <- err
+		}()
+
+		cancel()
+		require.ErrorIs(t, <-first, context.Canceled)
+
+		close(release)
+		require.NoError(t, <-waiter)
+	})
+
+	t.Run("it times out fetches", func(t *testing.T) {
+		loader := NewLoader(func(ctx context.Context, _ []int) (map[int]string, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, WithLoaderTimeout(time.Millisecond))
+
+		_, _, err := loader.Load(context.Background(), 1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("it uses primed values", func(t *testing.T) {
+		var log fetchLog
+
+		loader := NewLoader(log.fetch)
+		loader.Prime(1, "primed")
+
+		v, ok, err := loader.Load(context.Background(), 1)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "primed", v)
+		assert.Empty(t, log.calls)
+	})
+}
+
+func TestLoaderFromContext(t *testing.T) {
+	var log fetchLog
+
+	handler := LoaderMiddleware().Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		for range 3 {
+			_, err := LoaderFromContext(r.Context(), namesLoaderKey{}, log.fetch).LoadMany(r.Context(), []int{1, 2})
+			require.NoError(t, err)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, [][]int{{1, 2}, {1, 2}}, log.calls)
+}
@@ -0,0 +1,64 @@
+//go:build !production
+
+package apiresource
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+)
+
+func observerFromContext(ctx context.Context) (*observerState, bool) {
+	s, ok := ctx.Value(kObserverCtxKey).(*observerState)
+	return s, ok
+}
+
+// relationContext returns the context for rendering the relation at index i
+// of resources rendered with ctx.
+func relationContext(ctx context.Context, i int) context.Context {
+	s, ok := observerFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	path := strconv.Itoa(i)
+	if s.path != "" {
+		path = s.path + "." + path
+	}
+
+	return context.WithValue(ctx, kObserverCtxKey, &observerState{
+		observer: s.observer,
+		path:     path,
+		level:    s.level + 1,
+	})
+}
+
+// observeBundle notifies the observer, if any, about a Bundle call.
+func observeBundle[TResource any, TEntity any](ctx context.Context, entities []TEntity) (context.Context, func()) {
+	s, ok := observerFromContext(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+
+	return s.observer.ObserveBundle(ctx, BundleInfo{
+		Entities: entities,
+		Resource: reflect.TypeFor[TResource]().String(),
+		Path:     s.path,
+		Level:    s.level,
+	})
+}
+
+// observeRender notifies the observer, if any, about a Render call.
+func observeRender[TResource any, TEntity any](ctx context.Context, entity TEntity) (context.Context, func()) {
+	s, ok := observerFromContext(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+
+	return s.observer.ObserveRender(ctx, RenderInfo{
+		Entity:   entity,
+		Resource: reflect.TypeFor[TResource]().String(),
+		Path:     s.path,
+		Level:    s.level,
+	})
+}
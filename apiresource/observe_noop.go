@@ -0,0 +1,15 @@
+//go:build production
+
+package apiresource
+
+import "context"
+
+func relationContext(ctx context.Context, _ int) context.Context { return ctx }
+
+func observeBundle[TResource any, TEntity any](ctx context.Context, _ []TEntity) (context.Context, func()) {
+	return ctx, func() { /*noop*/ }
+}
+
+func observeRender[TResource any, TEntity any](ctx context.Context, _ TEntity) (context.Context, func()) {
+	return ctx, func() { /*noop*/ }
+}
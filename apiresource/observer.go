@@ -0,0 +1,72 @@
+package apiresource
+
+import (
+	"context"
+)
+
+type observerCtxKey struct{}
+
+//nolint:gochecknoglobals
+var kObserverCtxKey = observerCtxKey{}
+
+// BundleInfo describes a Bundle call.
+type BundleInfo struct {
+	// Entities is the []TEntity slice passed to Bundle.
+	Entities any
+
+	// Resource is the name of the resource type.
+	Resource string
+
+	// Path identifies the relation the resource is rendered for, it is made
+	// of indexes of relations returned by Composite.Relations on each level,
+	// joined with dots. It is empty for top-level resources.
+	Path string
+
+	// Level is the nesting level of the resource, 0 for top-level resources.
+	Level int
+}
+
+// RenderInfo describes a Render call.
+type RenderInfo struct {
+	// Entity is the entity passed to Render.
+	Entity any
+
+	// Resource is the name of the resource type.
+	Resource string
+
+	// Path identifies the relation the resource is rendered for,
+	// see BundleInfo.Path.
+	Path string
+
+	// Level is the nesting level of the resource, 0 for top-level resources.
+	Level int
+}
+
+// Observer observes Bundle and Render calls.
+//
+// It is primarily intended for testing, see the apiresourcetest package.
+// Observers must be safe for concurrent use.
+type Observer interface {
+	// ObserveBundle is called before Bundle and returns the context passed
+	// to Bundle and a function called once Bundle returns.
+	ObserveBundle(context.Context, BundleInfo) (context.Context, func())
+
+	// ObserveRender is called before Render and returns the context passed
+	// to Render and a function called once Render returns.
+	ObserveRender(context.Context, RenderInfo) (context.Context, func())
+}
+
+// WithObserver returns a new context with the observer o.
+//
+// Observers are not notified in builds with the production tag.
+func WithObserver(ctx context.Context, o Observer) context.Context {
+	return context.WithValue(ctx, kObserverCtxKey, &observerState{observer: o, path: "", level: 0})
+}
+
+// observerState is the observer and the position of resources rendered
+// with a context.
+type observerState struct {
+	observer Observer
+	path     string
+	level    int
+}
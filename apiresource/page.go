@@ -0,0 +1,259 @@
+package apiresource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.inout.gg/foundations/cursor"
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/http/httperror"
+)
+
+const (
+	// DefaultPageLimit is the default number of resources in a page.
+	DefaultPageLimit = 20
+
+	// DefaultPageMaxLimit is the default maximum number of resources in a page.
+	DefaultPageMaxLimit = 100
+)
+
+var ErrMalformedPage = errors.New("apiresource: malformed page request")
+
+// Direction is the direction of pagination relative to the cursor.
+type Direction string
+
+const (
+	// Forward paginates to the resources after the cursor.
+	Forward Direction = "forward"
+
+	// Backward paginates to the resources before the cursor.
+	Backward Direction = "backward"
+)
+
+// PageRequest describes a requested page of a cursor-paginated list.
+type PageRequest struct {
+	// Cursor is the opaque cursor of the page boundary, it is empty for
+	// the first page.
+	Cursor string
+
+	// Direction is the direction of pagination relative to Cursor.
+	Direction Direction
+
+	// Limit is the maximum number of resources in the page.
+	Limit int
+}
+
+// PageRequestOptions is used to configure PageRequestFromRequest.
+type PageRequestOptions struct {
+	// DefaultLimit is used when the limit is not provided.
+	//
+	// Defaults to DefaultPageLimit.
+	DefaultLimit int
+
+	// MaxLimit is the maximum allowed limit.
+	//
+	// Defaults to DefaultPageMaxLimit.
+	MaxLimit int
+}
+
+// PageRequestFromRequest parses the page request from the "limit", "cursor"
+// and "direction" query parameters of the request r.
+//
+// Invalid values are rejected with an httperror.HTTPError with
+// http.StatusBadRequest status.
+func PageRequestFromRequest(r *http.Request, opts *PageRequestOptions) (PageRequest, error) {
+	defaultLimit, maxLimit := DefaultPageLimit, DefaultPageMaxLimit
+
+	if opts != nil {
+		if opts.DefaultLimit > 0 {
+			defaultLimit = opts.DefaultLimit
+		}
+
+		if opts.MaxLimit > 0 {
+			maxLimit = opts.MaxLimit
+		}
+	}
+
+	query := r.URL.Query()
+	page := PageRequest{
+		Cursor:    query.Get("cursor"),
+		Direction: Forward,
+		Limit:     defaultLimit,
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return PageRequest{}, httperror.New(
+				fmt.Sprintf("limit must be an integer between 1 and %d", maxLimit),
+				http.StatusBadRequest,
+				ErrMalformedPage,
+			)
+		}
+
+		page.Limit = limit
+	}
+
+	switch d := Direction(query.Get("direction")); d {
+	case "", Forward:
+	case Backward:
+		page.Direction = Backward
+	default:
+		return PageRequest{}, httperror.New(
+			fmt.Sprintf("direction must be either %q or %q", Forward, Backward),
+			http.StatusBadRequest,
+			ErrMalformedPage,
+		)
+	}
+
+	return page, nil
+}
+
+// DecodeCursor decodes the page cursor into v using the codec.
+//
+// It reports false if the page has no cursor. An invalid cursor is rejected
+// with an httperror.HTTPError with http.StatusBadRequest status.
+func (p PageRequest) DecodeCursor(codec *cursor.Codec, v any) (bool, error) {
+	if p.Cursor == "" {
+		return false, nil
+	}
+
+	if err := codec.Decode(p.Cursor, v); err != nil {
+		return false, httperror.FromError(err, http.StatusBadRequest, "invalid cursor")
+	}
+
+	return true, nil
+}
+
+// List is a page of a cursor-paginated list of resources.
+//
+//nolint:tagliatelle // list envelope is a public API contract
+type List[TResource any] struct {
+	// Data are the resources of the page in the natural order.
+	Data []TResource `json:"data"`
+
+	// NextCursor is the cursor of the next page, empty if there is none.
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// PrevCursor is the cursor of the previous page, empty if there is none.
+	PrevCursor string `json:"prev_cursor,omitempty"`
+
+	// HasMore reports whether there are more resources in the requested
+	// direction, i.e. before the page when paginating Backward. Use
+	// NextCursor and PrevCursor to tell whether adjacent pages exist.
+	HasMore bool `json:"has_more"`
+}
+
+// Keyset describes how page cursors are built from entities.
+type Keyset[TEntity any] struct {
+	// Codec encodes cursors.
+	Codec *cursor.Codec
+
+	// Key returns keyset values of the entity, such as its sort key and ID.
+	Key func(TEntity) any
+}
+
+// RenderPage renders a page of resources into a List.
+//
+// entities are expected to be fetched with a limit of page.Limit+1 from
+// the position described by the page cursor, the extra entity is only used
+// to determine whether there are more resources. For the Backward direction
+// entities are expected in the reversed order, i.e. as fetched with inverted
+// ORDER BY, and are rendered in the natural order.
+//
+// The next cursor is built from the last entity of the page, and the previous
+// cursor from the first one.
+func RenderPage[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	page PageRequest,
+	keyset Keyset[TEntity],
+	opts ...func(*RenderOptions),
+) (*List[TRenderable], error) {
+	debug.Assert(page.Limit > 0, "expected page limit to be positive")
+	debug.Assert(keyset.Codec != nil, "expected keyset codec to be configured")
+	debug.Assert(keyset.Key != nil, "expected keyset key to be configured")
+
+	hasMore := len(entities) > page.Limit
+	if hasMore {
+		entities = entities[:page.Limit]
+	}
+
+	if page.Direction == Backward {
+		entities = slices.Clone(entities)
+		slices.Reverse(entities)
+	}
+
+	resources, err := RenderMany[TBundle, TRenderable](ctx, params, entities, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &List[TRenderable]{
+		Data:       resources,
+		NextCursor: "",
+		PrevCursor: "",
+		HasMore:    hasMore,
+	}
+
+	if len(entities) == 0 {
+		return list, nil
+	}
+
+	hasNext, hasPrev := cursor.Adjacent(hasMore, page.Cursor != "", page.Direction == Backward)
+
+	if hasNext {
+		if list.NextCursor, err = keyset.Codec.Encode(keyset.Key(entities[len(entities)-1])); err != nil {
+			return nil, fmt.Errorf("apiresource: failed to encode next cursor: %w", err)
+		}
+	}
+
+	if hasPrev {
+		if list.PrevCursor, err = keyset.Codec.Encode(keyset.Key(entities[0])); err != nil {
+			return nil, fmt.Errorf("apiresource: failed to encode previous cursor: %w", err)
+		}
+	}
+
+	return list, nil
+}
+
+// Link returns the value of an RFC 8288 Link header pointing to the next and
+// previous pages relative to the URL u.
+//
+// It returns an empty string if there are no adjacent pages.
+func (l *List[TResource]) Link(u *url.URL) string {
+	var links []string
+
+	if l.NextCursor != "" {
+		links = append(links, pageLink(u, l.NextCursor, Forward, "next"))
+	}
+
+	if l.PrevCursor != "" {
+		links = append(links, pageLink(u, l.PrevCursor, Backward, "prev"))
+	}
+
+	return strings.Join(links, ", ")
+}
+
+func pageLink(u *url.URL, cursor string, direction Direction, rel string) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	query.Set("direction", string(direction))
+
+	link := *u
+	link.RawQuery = query.Encode()
+
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
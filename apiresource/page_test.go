@@ -0,0 +1,143 @@
+package apiresource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/cursor"
+	"go.inout.gg/foundations/http/httperror"
+)
+
+func TestPageRequestFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    PageRequest
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  PageRequest{Cursor: "", Direction: Forward, Limit: DefaultPageLimit},
+		},
+		{
+			name:  "backward",
+			query: "limit=5&cursor=abc&direction=backward",
+			want:  PageRequest{Cursor: "abc", Direction: Backward, Limit: 5},
+		},
+		{name: "limit too large", query: "limit=1000", wantErr: true},
+		{name: "limit not a number", query: "limit=ten", wantErr: true},
+		{name: "unknown direction", query: "direction=up", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+
+			page, err := PageRequestFromRequest(r, nil)
+			if tt.wantErr {
+				var herr httperror.HTTPError
+				require.ErrorAs(t, err, &herr)
+				assert.Equal(t, http.StatusBadRequest, herr.StatusCode())
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, page)
+		})
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	codec := cursor.NewCodec([]byte(strings.Repeat("s", cursor.MinSecretLength)))
+	keyset := Keyset[userEntity]{Codec: codec, Key: func(e userEntity) any { return e.ID }}
+
+	decode := func(t *testing.T, s string) int {
+		t.Helper()
+
+		var id int
+
+		ok, err := PageRequest{Cursor: s, Direction: Forward, Limit: 1}.DecodeCursor(codec, &id)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		return id
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		page := PageRequest{Cursor: "", Direction: Forward, Limit: 2}
+
+		list, err := RenderPage[userBundle, userResource](context.Background(), userParams{}, users(3), page, keyset)
+		require.NoError(t, err)
+
+		require.Len(t, list.Data, 2)
+		assert.True(t, list.HasMore)
+		assert.Equal(t, 2, decode(t, list.NextCursor))
+		assert.Empty(t, list.PrevCursor)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		page := PageRequest{Cursor: "cursor", Direction: Forward, Limit: 2}
+
+		list, err := RenderPage[userBundle, userResource](context.Background(), userParams{}, users(2), page, keyset)
+		require.NoError(t, err)
+
+		require.Len(t, list.Data, 2)
+		assert.False(t, list.HasMore)
+		assert.Empty(t, list.NextCursor)
+		assert.Equal(t, 1, decode(t, list.PrevCursor))
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		page := PageRequest{Cursor: "cursor", Direction: Backward, Limit: 2}
+		entities := []userEntity{{ID: 5}, {ID: 4}, {ID: 3}}
+
+		list, err := RenderPage[userBundle, userResource](context.Background(), userParams{}, entities, page, keyset)
+		require.NoError(t, err)
+
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, "usr_4", list.Data[0].ID)
+		assert.Equal(t, "usr_5", list.Data[1].ID)
+		assert.True(t, list.HasMore)
+		assert.Equal(t, 4, decode(t, list.PrevCursor))
+		assert.Equal(t, 5, decode(t, list.NextCursor))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		page := PageRequest{Cursor: "", Direction: Forward, Limit: 2}
+
+		list, err := RenderPage[userBundle, userResource](context.Background(), userParams{}, nil, page, keyset)
+		require.NoError(t, err)
+		assert.Empty(t, list.Data)
+		assert.False(t, list.HasMore)
+		assert.Empty(t, list.Link(&url.URL{Path: "/users"}))
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		var id int
+
+		_, err := PageRequest{Cursor: "bogus", Direction: Forward, Limit: 1}.DecodeCursor(codec, &id)
+		require.ErrorIs(t, err, cursor.ErrInvalidCursor)
+	})
+}
+
+func TestListLink(t *testing.T) {
+	list := List[userResource]{Data: nil, NextCursor: "next", PrevCursor: "prev", HasMore: true}
+	u, err := url.Parse("https://example.com/users?limit=10")
+	require.NoError(t, err)
+
+	assert.Equal(
+		t,
+		`<https://example.com/users?cursor=next&direction=forward&limit=10>; rel="next", `+
+			`<https://example.com/users?cursor=prev&direction=backward&limit=10>; rel="prev"`,
+		list.Link(u),
+	)
+}
@@ -0,0 +1,91 @@
+package apiresource
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBrokenPart = errors.New("broken part")
+
+type assemblyResource struct {
+	Parts []partResource `json:"parts"`
+	ID    int            `json:"id"`
+}
+
+func (assemblyResource) Bundle(context.Context, userParams, []int) (struct{}, error) {
+	return struct{}{}, nil
+}
+
+func (assemblyResource) Render(_ context.Context, p userParams, _ struct{}, id int) (assemblyResource, error) {
+	if id == p.failOn {
+		return assemblyResource{}, errRender
+	}
+
+	return assemblyResource{ID: id}, nil
+}
+
+func (assemblyResource) Relations() []Relation[int, assemblyResource, userParams] {
+	return []Relation[int, assemblyResource, userParams]{
+		HasMany[struct{}, partResource](
+			func(id int) []int { return []int{id * 10, id*10 + 1} },
+			func(r *assemblyResource, parts []partResource) { r.Parts = parts },
+		),
+	}
+}
+
+type partResource struct {
+	ID int `json:"id"`
+}
+
+func (partResource) Bundle(ctx context.Context, _ userParams, ids []int) (struct{}, error) {
+	recordBundle(ctx, "part", len(ids))
+	return struct{}{}, nil
+}
+
+func (partResource) Render(_ context.Context, _ userParams, _ struct{}, id int) (partResource, error) {
+	if id == 31 {
+		return partResource{}, errBrokenPart
+	}
+
+	return partResource{ID: id}, nil
+}
+
+func TestRenderManyPartial(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run("concurrency "+strconv.Itoa(concurrency), func(t *testing.T) {
+			ctx, log := withBundleLog(context.Background())
+
+			resources, errs, err := RenderManyPartial[struct{}, assemblyResource](
+				ctx,
+				userParams{failOn: 2},
+				[]int{1, 2, 3, 4},
+				WithConcurrency(concurrency),
+			)
+			require.NoError(t, err)
+
+			require.Len(t, resources, 2)
+			assert.Equal(t, 1, resources[0].ID)
+			assert.Equal(t, []partResource{{ID: 10}, {ID: 11}}, resources[0].Parts)
+			assert.Equal(t, 4, resources[1].ID)
+
+			require.Len(t, errs, 2)
+			assert.Equal(t, 1, errs[0].Index)
+			require.ErrorIs(t, errs[0], errRender)
+			assert.Equal(t, 2, errs[1].Index)
+			require.ErrorIs(t, errs[1], errBrokenPart)
+
+			// Children of the failed parent are not rendered.
+			assert.Equal(t, []int{6}, log.calls["part"])
+		})
+	}
+
+	t.Run("fail fast remains the default", func(t *testing.T) {
+		_, err := RenderMany[struct{}, assemblyResource](context.Background(), userParams{}, []int{1, 3})
+		require.ErrorIs(t, err, errBrokenPart)
+	})
+}
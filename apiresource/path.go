@@ -0,0 +1,60 @@
+package apiresource
+
+import (
+	"slices"
+	"strings"
+)
+
+const pathSeparator = "."
+
+// pathTree is a set of dot-separated paths stored as a tree of segments.
+type pathTree map[string]pathTree
+
+func splitPath(p string) []string { return strings.Split(p, pathSeparator) }
+
+func (t pathTree) add(segments []string) {
+	node := t
+	for _, s := range segments {
+		child, ok := node[s]
+		if !ok {
+			child = make(pathTree)
+			node[s] = child
+		}
+
+		node = child
+	}
+}
+
+func (t pathTree) contains(segments []string) bool {
+	node := t
+	for _, s := range segments {
+		child, ok := node[s]
+		if !ok {
+			return false
+		}
+
+		node = child
+	}
+
+	return true
+}
+
+// paths returns all leaf paths of the tree in lexicographical order.
+func (t pathTree) paths() []string {
+	var paths []string
+
+	for segment, child := range t {
+		if len(child) == 0 {
+			paths = append(paths, segment)
+			continue
+		}
+
+		for _, p := range child.paths() {
+			paths = append(paths, segment+pathSeparator+p)
+		}
+	}
+
+	slices.Sort(paths)
+
+	return paths
+}
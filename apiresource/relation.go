@@ -0,0 +1,212 @@
+package apiresource
+
+import (
+	"context"
+)
+
+// Relation describes child resources embedded into the resources rendered
+// from TEntity.
+//
+// Use HasMany and HasOne to declare a relation.
+type Relation[TEntity any, TResource any, TParams any] interface {
+	// resolve renders children of all entities at once and attaches them
+	// to the corresponding resources.
+	//
+	// In the partial mode errs holds errors of entities that failed to render,
+	// which are skipped, and receives errors of their children.
+	resolve(
+		ctx context.Context,
+		params TParams,
+		entities []TEntity,
+		resources []TResource,
+		errs []error,
+		options RenderOptions,
+	) error
+}
+
+// Composite is implemented by resources that embed child resources.
+//
+// Instead of rendering children inside Render, which brings back the N+1
+// problem, a Composite declares its relations. RenderMany gathers child
+// entities across the whole batch of parents, loads each child Bundle once
+// per level and attaches the rendered children to their parents.
+type Composite[TEntity any, TResource any, TParams any] interface {
+	Relations() []Relation[TEntity, TResource, TParams]
+}
+
+// HasMany declares a one-to-many relation.
+//
+// children returns child entities of the given parent entity, and attach
+// sets the rendered children on the parent resource. Children are passed to
+// attach in the same order as they were returned by children.
+func HasMany[
+	TChildBundle any,
+	TChild Renderable[TChildBundle, TChildEntity, TChild, TParams],
+	TChildEntity any,
+	TEntity any,
+	TResource any,
+	TParams any,
+](
+	children func(TEntity) []TChildEntity,
+	attach func(*TResource, []TChild),
+) Relation[TEntity, TResource, TParams] {
+	return &hasMany[TChildBundle, TChild, TChildEntity, TEntity, TResource, TParams]{
+		children: children,
+		attach:   attach,
+	}
+}
+
+// HasOne declares a one-to-one relation.
+//
+// child returns the child entity of the given parent entity, or false if
+// the parent has no child, in which case attach is not called.
+func HasOne[
+	TChildBundle any,
+	TChild Renderable[TChildBundle, TChildEntity, TChild, TParams],
+	TChildEntity any,
+	TEntity any,
+	TResource any,
+	TParams any,
+](
+	child func(TEntity) (TChildEntity, bool),
+	attach func(*TResource, TChild),
+) Relation[TEntity, TResource, TParams] {
+	return &hasOne[TChildBundle, TChild, TChildEntity, TEntity, TResource, TParams]{
+		child:  child,
+		attach: attach,
+	}
+}
+
+type hasMany[
+	TChildBundle any,
+	TChild Renderable[TChildBundle, TChildEntity, TChild, TParams],
+	TChildEntity any,
+	TEntity any,
+	TResource any,
+	TParams any,
+] struct {
+	children func(TEntity) []TChildEntity
+	attach   func(*TResource, []TChild)
+}
+
+func (r *hasMany[TChildBundle, TChild, TChildEntity, TEntity, TResource, TParams]) resolve(
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	resources []TResource,
+	errs []error,
+	options RenderOptions,
+) error {
+	var (
+		offsets  = make([]int, len(entities)+1)
+		children []TChildEntity
+	)
+
+	for i, entity := range entities {
+		if !failed(errs, i) {
+			children = append(children, r.children(entity)...)
+		}
+
+		offsets[i+1] = len(children)
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	rendered, childErrs, err := renderMany[TChildBundle, TChild](ctx, params, children, options)
+	if err != nil {
+		return err
+	}
+
+	for i := range resources {
+		if failed(errs, i) {
+			continue
+		}
+
+		lo, hi := offsets[i], offsets[i+1]
+		if err := firstError(childErrs, lo, hi); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		r.attach(&resources[i], rendered[lo:hi:hi])
+	}
+
+	return nil
+}
+
+type hasOne[
+	TChildBundle any,
+	TChild Renderable[TChildBundle, TChildEntity, TChild, TParams],
+	TChildEntity any,
+	TEntity any,
+	TResource any,
+	TParams any,
+] struct {
+	child  func(TEntity) (TChildEntity, bool)
+	attach func(*TResource, TChild)
+}
+
+func (r *hasOne[TChildBundle, TChild, TChildEntity, TEntity, TResource, TParams]) resolve(
+	ctx context.Context,
+	params TParams,
+	entities []TEntity,
+	resources []TResource,
+	errs []error,
+	options RenderOptions,
+) error {
+	var (
+		parents  = make([]int, 0, len(entities))
+		children = make([]TChildEntity, 0, len(entities))
+	)
+
+	for i, entity := range entities {
+		if failed(errs, i) {
+			continue
+		}
+
+		if child, ok := r.child(entity); ok {
+			parents = append(parents, i)
+			children = append(children, child)
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	rendered, childErrs, err := renderMany[TChildBundle, TChild](ctx, params, children, options)
+	if err != nil {
+		return err
+	}
+
+	for i, parent := range parents {
+		if failed(childErrs, i) {
+			errs[parent] = childErrs[i]
+			continue
+		}
+
+		r.attach(&resources[parent], rendered[i])
+	}
+
+	return nil
+}
+
+// failed reports whether the entity at index i failed to render.
+func failed(errs []error, i int) bool { return errs != nil && errs[i] != nil }
+
+// firstError returns the first error in errs[lo:hi].
+func firstError(errs []error, lo, hi int) error {
+	if errs == nil {
+		return nil
+	}
+
+	for _, err := range errs[lo:hi] {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
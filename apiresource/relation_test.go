@@ -0,0 +1,154 @@
+package apiresource
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderEntity struct {
+	ID    int
+	Items []itemEntity
+}
+
+type itemEntity struct {
+	ID        int
+	ProductID int
+}
+
+type shopParams struct{}
+
+// bundleLog records Bundle calls per resource type.
+type bundleLog struct {
+	calls map[string][]int
+	mu    sync.Mutex
+}
+
+func (l *bundleLog) record(name string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls[name] = append(l.calls[name], n)
+}
+
+type bundleLogKey struct{}
+
+func withBundleLog(ctx context.Context) (context.Context, *bundleLog) {
+	l := &bundleLog{calls: make(map[string][]int)}
+	return context.WithValue(ctx, bundleLogKey{}, l), l
+}
+
+func recordBundle(ctx context.Context, name string, n int) {
+	if l, ok := ctx.Value(bundleLogKey{}).(*bundleLog); ok {
+		l.record(name, n)
+	}
+}
+
+type orderResource struct {
+	ID    int            `json:"id"`
+	Items []itemResource `json:"items"`
+}
+
+func (orderResource) Bundle(ctx context.Context, _ shopParams, entities []orderEntity) (struct{}, error) {
+	recordBundle(ctx, "order", len(entities))
+	return struct{}{}, nil
+}
+
+func (orderResource) Render(_ context.Context, _ shopParams, _ struct{}, entity orderEntity) (orderResource, error) {
+	return orderResource{ID: entity.ID}, nil
+}
+
+func (orderResource) Relations() []Relation[orderEntity, orderResource, shopParams] {
+	return []Relation[orderEntity, orderResource, shopParams]{
+		HasMany[struct{}, itemResource](
+			func(o orderEntity) []itemEntity { return o.Items },
+			func(r *orderResource, items []itemResource) { r.Items = items },
+		),
+	}
+}
+
+type itemResource struct {
+	Product *productResource `json:"product"`
+	ID      int              `json:"id"`
+}
+
+func (itemResource) Bundle(ctx context.Context, _ shopParams, entities []itemEntity) (struct{}, error) {
+	recordBundle(ctx, "item", len(entities))
+	return struct{}{}, nil
+}
+
+func (itemResource) Render(_ context.Context, _ shopParams, _ struct{}, entity itemEntity) (itemResource, error) {
+	return itemResource{ID: entity.ID}, nil
+}
+
+func (itemResource) Relations() []Relation[itemEntity, itemResource, shopParams] {
+	return []Relation[itemEntity, itemResource, shopParams]{
+		HasOne[map[int]string, productResource](
+			func(i itemEntity) (int, bool) { return i.ProductID, i.ProductID != 0 },
+			func(r *itemResource, p productResource) { r.Product = &p },
+		),
+	}
+}
+
+type productResource struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+func (productResource) Bundle(ctx context.Context, _ shopParams, ids []int) (map[int]string, error) {
+	recordBundle(ctx, "product", len(ids))
+
+	names := make(map[int]string, len(ids))
+	for _, id := range ids {
+		names[id] = "product"
+	}
+
+	return names, nil
+}
+
+func (productResource) Render(_ context.Context, _ shopParams, names map[int]string, id int) (productResource, error) {
+	return productResource{ID: id, Name: names[id]}, nil
+}
+
+func TestRelations(t *testing.T) {
+	orders := []orderEntity{
+		{ID: 1, Items: []itemEntity{{ID: 11, ProductID: 100}, {ID: 12, ProductID: 0}}},
+		{ID: 2, Items: nil},
+		{ID: 3, Items: []itemEntity{{ID: 31, ProductID: 300}}},
+	}
+
+	t.Run("batches bundles per level", func(t *testing.T) {
+		ctx, log := withBundleLog(context.Background())
+
+		resources, err := RenderMany[struct{}, orderResource](ctx, shopParams{}, orders, WithConcurrency(2))
+		require.NoError(t, err)
+		require.Len(t, resources, 3)
+
+		assert.Equal(t, map[string][]int{
+			"order":   {3},
+			"item":    {3},
+			"product": {2},
+		}, log.calls)
+
+		require.Len(t, resources[0].Items, 2)
+		assert.Equal(t, 11, resources[0].Items[0].ID)
+		assert.Equal(t, 100, resources[0].Items[0].Product.ID)
+		assert.Nil(t, resources[0].Items[1].Product)
+		assert.Empty(t, resources[1].Items)
+		require.Len(t, resources[2].Items, 1)
+		assert.Equal(t, 300, resources[2].Items[0].Product.ID)
+	})
+
+	t.Run("render resolves relations", func(t *testing.T) {
+		ctx, log := withBundleLog(context.Background())
+
+		resource, err := Render[orderResource](ctx, shopParams{}, orders[0])
+		require.NoError(t, err)
+		require.Len(t, resource.Items, 2)
+		assert.Equal(t, "product", resource.Items[0].Product.Name)
+		assert.Equal(t, []int{1}, log.calls["product"])
+	})
+}
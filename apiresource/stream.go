@@ -0,0 +1,221 @@
+package apiresource
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+)
+
+// DefaultStreamChunkSize is the default number of entities bundled at once by Stream.
+const DefaultStreamChunkSize = 500
+
+// StreamFormat is the output format of Stream.
+type StreamFormat int
+
+const (
+	// JSONArray writes resources as a single JSON array.
+	JSONArray StreamFormat = iota
+
+	// NDJSON writes resources as newline-delimited JSON.
+	NDJSON
+)
+
+// StreamOptions is used to configure Stream.
+type StreamOptions struct {
+	RenderOptions
+
+	// Format is the output format, defaults to JSONArray.
+	Format StreamFormat
+
+	// ChunkSize is the number of entities bundled and rendered at once.
+	//
+	// Defaults to DefaultStreamChunkSize.
+	ChunkSize int
+
+	// FlushEvery is the number of chunks written between flushes of
+	// the writer, defaults to 1.
+	FlushEvery int
+}
+
+// Stream renders entities in fixed-size chunks and writes the resources to w
+// as they are rendered, so the whole list is never held in memory.
+//
+// Each chunk is rendered as with RenderMany, i.e. Bundle is loaded once per
+// chunk. The writer is flushed periodically if it implements http.Flusher or
+// has a Flush() error method.
+//
+// Stream stops once ctx is cancelled. On error the output is incomplete, e.g.
+// a JSON array is left unterminated. It returns the number of written resources.
+func Stream[
+	TBundle any,
+	TRenderable Renderable[TBundle, TEntity, TRenderable, TParams],
+	TEntity any,
+	TParams any,
+](
+	ctx context.Context,
+	params TParams,
+	entities iter.Seq[TEntity],
+	w io.Writer,
+	opts *StreamOptions,
+) (int, error) {
+	//nolint:exhaustruct
+	options := StreamOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = DefaultStreamChunkSize
+	}
+
+	if options.FlushEvery <= 0 {
+		options.FlushEvery = 1
+	}
+
+	s := &streamWriter{
+		buf:    bufio.NewWriter(w),
+		dst:    w,
+		format: options.Format,
+		count:  0,
+	}
+
+	if err := s.begin(); err != nil {
+		return 0, err
+	}
+
+	var (
+		chunk  = make([]TEntity, 0, options.ChunkSize)
+		chunks int
+	)
+
+	flushChunk := func() error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("apiresource: streaming cancelled: %w", err)
+		}
+
+		resources, _, err := renderMany[TBundle, TRenderable](ctx, params, chunk, options.RenderOptions)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range resources {
+			if err := s.write(r); err != nil {
+				return err
+			}
+		}
+
+		chunk = chunk[:0]
+		chunks++
+
+		if chunks%options.FlushEvery == 0 {
+			return s.flush()
+		}
+
+		return nil
+	}
+
+	for entity := range entities {
+		if err := ctx.Err(); err != nil {
+			return s.count, fmt.Errorf("apiresource: streaming cancelled: %w", err)
+		}
+
+		chunk = append(chunk, entity)
+		if len(chunk) == options.ChunkSize {
+			if err := flushChunk(); err != nil {
+				return s.count, err
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		if err := flushChunk(); err != nil {
+			return s.count, err
+		}
+	}
+
+	if err := s.end(); err != nil {
+		return s.count, err
+	}
+
+	return s.count, s.flush()
+}
+
+// streamWriter writes encoded resources in the given format.
+type streamWriter struct {
+	buf    *bufio.Writer
+	dst    io.Writer
+	format StreamFormat
+	count  int
+}
+
+func (s *streamWriter) begin() error {
+	if s.format == JSONArray {
+		return s.writeByte('[')
+	}
+
+	return nil
+}
+
+func (s *streamWriter) end() error {
+	if s.format == JSONArray {
+		return s.writeByte(']')
+	}
+
+	return nil
+}
+
+func (s *streamWriter) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("apiresource: failed to encode resource: %w", err)
+	}
+
+	if s.format == JSONArray && s.count > 0 {
+		if err := s.writeByte(','); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.buf.Write(b); err != nil {
+		return fmt.Errorf("apiresource: failed to write resource: %w", err)
+	}
+
+	if s.format == NDJSON {
+		if err := s.writeByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	s.count++
+
+	return nil
+}
+
+func (s *streamWriter) writeByte(c byte) error {
+	if err := s.buf.WriteByte(c); err != nil {
+		return fmt.Errorf("apiresource: failed to write resource: %w", err)
+	}
+
+	return nil
+}
+
+func (s *streamWriter) flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("apiresource: failed to flush stream: %w", err)
+	}
+
+	switch f := s.dst.(type) {
+	case http.Flusher:
+		f.Flush()
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("apiresource: failed to flush stream: %w", err)
+		}
+	}
+
+	return nil
+}
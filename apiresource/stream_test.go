@@ -0,0 +1,104 @@
+package apiresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func userSeq(n int) iter.Seq[userEntity] { return slices.Values(users(n)) }
+
+func TestStream(t *testing.T) {
+	t.Run("json array", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		n, err := Stream[userBundle, userResource](
+			context.Background(),
+			userParams{},
+			userSeq(5),
+			&buf,
+			&StreamOptions{ChunkSize: 2},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+
+		var resources []userResource
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &resources))
+		require.Len(t, resources, 5)
+		assert.Equal(t, "usr_5", resources[4].ID)
+	})
+
+	t.Run("empty json array", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		n, err := Stream[userBundle, userResource](context.Background(), userParams{}, userSeq(0), &buf, nil)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		assert.Equal(t, "[]", buf.String())
+	})
+
+	t.Run("ndjson with flushing", func(t *testing.T) {
+		userBundleCalls.Store(0)
+
+		rr := httptest.NewRecorder()
+
+		n, err := Stream[userBundle, userResource](
+			context.Background(),
+			userParams{},
+			userSeq(5),
+			rr,
+			&StreamOptions{Format: NDJSON, ChunkSize: 2, FlushEvery: 1},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+		assert.True(t, rr.Flushed)
+		assert.Equal(t, int64(3), userBundleCalls.Load())
+
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		require.Len(t, lines, 5)
+		assert.JSONEq(t, `{"id":"usr_1","name":"user 1"}`, lines[0])
+	})
+
+	t.Run("it stops on cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		entities := func(yield func(userEntity) bool) {
+			for i, e := range users(10) {
+				if i == 3 {
+					cancel()
+				}
+
+				if !yield(e) {
+					return
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+
+		n, err := Stream[userBundle, userResource](ctx, userParams{}, entities, &buf, &StreamOptions{ChunkSize: 2})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("it stops on error", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		_, err := Stream[userBundle, userResource](
+			context.Background(),
+			userParams{failOn: 3},
+			userSeq(5),
+			&buf,
+			&StreamOptions{ChunkSize: 2},
+		)
+		require.ErrorIs(t, err, errRender)
+	})
+}
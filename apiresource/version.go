@@ -0,0 +1,266 @@
+package apiresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/http/httperror"
+	"go.inout.gg/foundations/http/httphandler"
+	"go.inout.gg/foundations/http/httpmiddleware"
+)
+
+// DefaultVersionHeader is the default header carrying the requested API version.
+const DefaultVersionHeader = "API-Version"
+
+type versionCtxKey struct{}
+
+var kVersionCtxKey = versionCtxKey{} //nolint:gochecknoglobals
+
+var ErrUnknownVersion = errors.New("apiresource: unknown API version")
+
+// Versions is an ordered list of API versions, e.g. "2024-01-01", from
+// the oldest to the latest.
+type Versions struct {
+	index map[string]int
+	list  []string
+}
+
+// NewVersions creates a new list of versions ordered from the oldest to the latest.
+func NewVersions(versions ...string) *Versions {
+	debug.Assert(len(versions) > 0, "expected at least one version")
+
+	index := make(map[string]int, len(versions))
+	for i, v := range versions {
+		_, ok := index[v]
+		debug.Assert(!ok, "duplicate version %q", v)
+
+		index[v] = i
+	}
+
+	return &Versions{index: index, list: slices.Clone(versions)}
+}
+
+// Latest returns the latest version.
+func (v *Versions) Latest() string { return v.list[len(v.list)-1] }
+
+// Parse checks that s is a known version.
+//
+// Unknown versions are rejected with an httperror.HTTPError with
+// http.StatusBadRequest status.
+func (v *Versions) Parse(s string) (string, error) {
+	if _, ok := v.index[s]; !ok {
+		return "", httperror.New(fmt.Sprintf("unknown API version %q", s), http.StatusBadRequest, ErrUnknownVersion)
+	}
+
+	return s, nil
+}
+
+// WithVersion returns a new context with the requested API version.
+func WithVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, kVersionCtxKey, version)
+}
+
+// VersionFromContext returns the requested API version associated with the context.
+func VersionFromContext(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(kVersionCtxKey).(string)
+	return version, ok
+}
+
+// VersionOptions is used to configure VersionMiddleware.
+type VersionOptions struct {
+	// Default returns the version used when the request does not carry
+	// the version header, e.g. the version the account is pinned to.
+	//
+	// If Default is nil or returns an empty string, the latest version is used.
+	Default func(*http.Request) string
+
+	// Header is the header carrying the requested version.
+	//
+	// Defaults to DefaultVersionHeader.
+	Header string
+
+	// ErrorHandler handles the error of an unknown version.
+	//
+	// Defaults to httphandler.DefaultErrorHandler.
+	ErrorHandler httphandler.ErrorHandler
+}
+
+// VersionMiddleware returns a middleware that resolves the requested API
+// version and stores it in the request context.
+//
+// Requests with an unknown version are rejected with the error returned by
+// Versions.Parse, which is passed to the error handler.
+func VersionMiddleware(versions *Versions, opts *VersionOptions) httpmiddleware.MiddlewareFunc {
+	header := DefaultVersionHeader
+
+	var (
+		fallback     func(*http.Request) string
+		errorHandler httphandler.ErrorHandler = httphandler.DefaultErrorHandler
+	)
+
+	if opts != nil {
+		if opts.Header != "" {
+			header = opts.Header
+		}
+
+		if opts.ErrorHandler != nil {
+			errorHandler = opts.ErrorHandler
+		}
+
+		fallback = opts.Default
+	}
+
+	return httpmiddleware.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version := r.Header.Get(header)
+			if version == "" && fallback != nil {
+				version = fallback(r)
+			}
+
+			if version == "" {
+				version = versions.Latest()
+			}
+
+			version, err := versions.Parse(version)
+			if err != nil {
+				errorHandler.ServeHTTP(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithVersion(r.Context(), version)))
+		})
+	})
+}
+
+// VersionChange downgrades the JSON representation of a resource from
+// the version that introduced the change to the previous version.
+type VersionChange func(ctx context.Context, resource map[string]any) error
+
+// VersionGates is a chain of changes made to TResource across API versions.
+//
+// Resources are always rendered in their latest shape, and then downgraded
+// step by step to the requested version by applying changes in reverse
+// order, so Render implementations are never forked per version.
+type VersionGates[TResource any] struct {
+	versions *Versions
+	changes  map[int][]VersionChange
+}
+
+// NewVersionGates creates a new chain of version gates for TResource.
+func NewVersionGates[TResource any](versions *Versions) *VersionGates[TResource] {
+	return &VersionGates[TResource]{versions: versions, changes: make(map[int][]VersionChange)}
+}
+
+// Gate registers a change introduced in the version.
+//
+// The change is applied when downgrading a resource to any version older
+// than the given one. Changes registered for the same version are applied
+// in reverse order of registration.
+func (g *VersionGates[TResource]) Gate(version string, change VersionChange) *VersionGates[TResource] {
+	i, ok := g.versions.index[version]
+	debug.Assert(ok, "unknown version %q", version)
+
+	g.changes[i] = append(g.changes[i], change)
+
+	return g
+}
+
+// Downgrade encodes the resource and downgrades it to the version.
+func (g *VersionGates[TResource]) Downgrade(
+	ctx context.Context,
+	resource TResource,
+	version string,
+) (json.RawMessage, error) {
+	target, ok := g.versions.index[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+	}
+
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil, fmt.Errorf("apiresource: failed to encode resource: %w", err)
+	}
+
+	if !g.hasChangesAfter(target) {
+		return b, nil
+	}
+
+	var m map[string]any
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("apiresource: failed to decode resource: %w", err)
+	}
+
+	for i := len(g.versions.list) - 1; i > target; i-- {
+		changes := g.changes[i]
+		for j := len(changes) - 1; j >= 0; j-- {
+			if err := changes[j](ctx, m); err != nil {
+				return nil, fmt.Errorf(
+					"apiresource: failed to downgrade resource to version %q: %w",
+					g.versions.list[i-1],
+					err,
+				)
+			}
+		}
+	}
+
+	b, err = json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("apiresource: failed to encode resource: %w", err)
+	}
+
+	return b, nil
+}
+
+// DowngradeMany is similar to Downgrade, but downgrades many resources at once.
+func (g *VersionGates[TResource]) DowngradeMany(
+	ctx context.Context,
+	resources []TResource,
+	version string,
+) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, len(resources))
+
+	for i, r := range resources {
+		b, err := g.Downgrade(ctx, r, version)
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = b
+	}
+
+	return result, nil
+}
+
+// DowngradeFromContext downgrades the resource to the version associated
+// with the context, or leaves it in the latest shape if there is none.
+func (g *VersionGates[TResource]) DowngradeFromContext(
+	ctx context.Context,
+	resource TResource,
+) (json.RawMessage, error) {
+	version, ok := VersionFromContext(ctx)
+	if !ok {
+		version = g.versions.Latest()
+	}
+
+	return g.Downgrade(ctx, resource, version)
+}
+
+func (g *VersionGates[TResource]) hasChangesAfter(target int) bool {
+	for i := target + 1; i < len(g.versions.list); i++ {
+		if len(g.changes[i]) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
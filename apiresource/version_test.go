@@ -0,0 +1,125 @@
+package apiresource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/http/httperror"
+	"go.inout.gg/foundations/http/httphandler"
+)
+
+type planResource struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+	Status string `json:"status"`
+}
+
+func TestVersionGates(t *testing.T) {
+	versions := NewVersions("2023-01-01", "2024-01-01", "2025-01-01")
+
+	gates := NewVersionGates[planResource](versions).
+		// 2024-01-01 renamed "active" to "status".
+		Gate("2024-01-01", func(_ context.Context, r map[string]any) error {
+			r["active"] = r["status"] == "active"
+			delete(r, "status")
+
+			return nil
+		}).
+		// 2025-01-01 renamed "amount_cents" to "amount".
+		Gate("2025-01-01", func(_ context.Context, r map[string]any) error {
+			r["amount_cents"] = r["amount"]
+			delete(r, "amount")
+
+			return nil
+		})
+
+	plan := planResource{ID: "plan_1", Amount: 9007199254740993, Status: "active"}
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "2025-01-01", want: `{"id":"plan_1","amount":9007199254740993,"status":"active"}`},
+		{version: "2024-01-01", want: `{"amount_cents":9007199254740993,"id":"plan_1","status":"active"}`},
+		{version: "2023-01-01", want: `{"active":true,"amount_cents":9007199254740993,"id":"plan_1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := gates.Downgrade(context.Background(), plan, tt.version)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := gates.Downgrade(context.Background(), plan, "2022-01-01")
+		require.ErrorIs(t, err, ErrUnknownVersion)
+	})
+}
+
+func TestVersionMiddleware(t *testing.T) {
+	versions := NewVersions("2023-01-01", "2024-01-01")
+
+	serve := func(opts *VersionOptions, header string) (*httptest.ResponseRecorder, string) {
+		var version string
+
+		handler := VersionMiddleware(versions, opts).Middleware(
+			http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				version, _ = VersionFromContext(r.Context())
+			}),
+		)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set(DefaultVersionHeader, header)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		return rr, version
+	}
+
+	t.Run("header", func(t *testing.T) {
+		_, version := serve(nil, "2023-01-01")
+		assert.Equal(t, "2023-01-01", version)
+	})
+
+	t.Run("latest by default", func(t *testing.T) {
+		_, version := serve(nil, "")
+		assert.Equal(t, "2024-01-01", version)
+	})
+
+	t.Run("account default", func(t *testing.T) {
+		_, version := serve(&VersionOptions{Default: func(*http.Request) string { return "2023-01-01" }}, "")
+		assert.Equal(t, "2023-01-01", version)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		rr, _ := serve(nil, "1999-01-01")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("unknown version error handler", func(t *testing.T) {
+		var handled error
+
+		rr, _ := serve(&VersionOptions{
+			ErrorHandler: httphandler.ErrorHandlerFunc(func(w http.ResponseWriter, _ *http.Request, err error) {
+				handled = err
+				w.WriteHeader(http.StatusTeapot)
+			}),
+		}, "1999-01-01")
+		assert.Equal(t, http.StatusTeapot, rr.Code)
+		require.ErrorIs(t, handled, ErrUnknownVersion)
+
+		var herr httperror.HTTPError
+		require.ErrorAs(t, handled, &herr)
+		assert.Equal(t, http.StatusBadRequest, herr.StatusCode())
+	})
+}
@@ -0,0 +1,91 @@
+// Package cursor implements opaque, tamper-resistant pagination cursors.
+//
+// A cursor carries keyset values, such as the sort key and ID of the
+// boundary row of a page, encoded as JSON and signed with HMAC-SHA256.
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.inout.gg/foundations/debug"
+)
+
+// MinSecretLength is the minimum length of the secret used to sign cursors.
+const MinSecretLength = 32
+
+var ErrInvalidCursor = errors.New("cursor: invalid cursor")
+
+//nolint:gochecknoglobals
+var encoding = base64.RawURLEncoding
+
+// Codec encodes and decodes signed cursors.
+type Codec struct {
+	secret []byte
+}
+
+// NewCodec creates a new Codec signing cursors with the given secret.
+//
+// The secret must be at least MinSecretLength bytes long.
+func NewCodec(secret []byte) *Codec {
+	debug.Assert(len(secret) >= MinSecretLength, "expected secret to be at least %d bytes", MinSecretLength)
+
+	return &Codec{secret: secret}
+}
+
+// Encode encodes v into an opaque cursor.
+func (c *Codec) Encode(v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("cursor: failed to encode cursor: %w", err)
+	}
+
+	return encoding.EncodeToString(append(payload, c.sign(payload)...)), nil
+}
+
+// Decode decodes the cursor s into v.
+//
+// If s is malformed or its signature does not match, ErrInvalidCursor
+// is returned.
+func (c *Codec) Decode(s string, v any) error {
+	b, err := encoding.DecodeString(s)
+	if err != nil || len(b) < sha256.Size {
+		return ErrInvalidCursor
+	}
+
+	payload, mac := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if !hmac.Equal(mac, c.sign(payload)) {
+		return ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	return nil
+}
+
+func (c *Codec) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	_, _ = h.Write(payload)
+
+	return h.Sum(nil)
+}
+
+// Adjacent reports whether a page has next and previous pages.
+//
+// hasMore reports whether rows past the page were found in the requested
+// direction, and hasCursor whether the page was requested from a cursor
+// rather than from the start. When paginating backward, the next and
+// previous pages are swapped.
+func Adjacent(hasMore, hasCursor, backward bool) (hasNext, hasPrev bool) {
+	if backward {
+		return hasCursor, hasMore
+	}
+
+	return hasMore, hasCursor
+}
@@ -0,0 +1,68 @@
+package cursor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type key struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int64     `json:"i"`
+}
+
+func TestCodec(t *testing.T) {
+	codec := NewCodec([]byte(strings.Repeat("s", MinSecretLength)))
+	want := key{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ID: 42}
+
+	t.Run("it works", func(t *testing.T) {
+		s, err := codec.Encode(want)
+		require.NoError(t, err)
+
+		var got key
+		require.NoError(t, codec.Decode(s, &got))
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("it rejects tampered cursor", func(t *testing.T) {
+		s, err := codec.Encode(want)
+		require.NoError(t, err)
+
+		tampered := []byte(s)
+		tampered[0] ^= 1
+
+		var got key
+		require.ErrorIs(t, codec.Decode(string(tampered), &got), ErrInvalidCursor)
+	})
+
+	t.Run("it rejects cursor signed with another secret", func(t *testing.T) {
+		s, err := NewCodec([]byte(strings.Repeat("x", MinSecretLength))).Encode(want)
+		require.NoError(t, err)
+
+		var got key
+		require.ErrorIs(t, codec.Decode(s, &got), ErrInvalidCursor)
+	})
+
+	t.Run("it rejects malformed cursor", func(t *testing.T) {
+		var got key
+		require.ErrorIs(t, codec.Decode("not a cursor", &got), ErrInvalidCursor)
+		require.ErrorIs(t, codec.Decode("", &got), ErrInvalidCursor)
+	})
+}
+
+func TestAdjacent(t *testing.T) {
+	t.Run("it works forward", func(t *testing.T) {
+		hasNext, hasPrev := Adjacent(true, false, false)
+		assert.True(t, hasNext)
+		assert.False(t, hasPrev)
+	})
+
+	t.Run("it swaps pages backward", func(t *testing.T) {
+		hasNext, hasPrev := Adjacent(true, false, true)
+		assert.False(t, hasNext)
+		assert.True(t, hasPrev)
+	})
+}
@@ -0,0 +1,38 @@
+package dbsql
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff returns a jittered exponential delay before the given attempt,
+// starting at minBackoff and capped at maxBackoff.
+//
+// The delay is picked at random from the upper half of the exponential
+// delay, so that clients failing at once do not retry in lockstep.
+// Attempts are counted from 1, lower values are treated as 1.
+func Backoff(attempt int, minBackoff, maxBackoff time.Duration) time.Duration {
+	shift := max(attempt, 1) - 1
+
+	// Shifting maxBackoff right instead of minBackoff left cannot overflow.
+	d := maxBackoff
+	if minBackoff > 0 && shift < 63 && minBackoff <= maxBackoff>>shift {
+		d = minBackoff << shift
+	}
+
+	return d/2 + rand.N(d/2+1) //nolint:gosec // jitter does not need a secure random
+}
+
+// sleep waits for d and reports whether ctx is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
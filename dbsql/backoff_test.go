@@ -0,0 +1,24 @@
+package dbsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{
+		-1:  time.Second,
+		0:   time.Second,
+		1:   time.Second,
+		3:   4 * time.Second,
+		10:  time.Minute,
+		37:  time.Minute,
+		100: time.Minute,
+	} {
+		d := Backoff(attempt, time.Second, time.Minute)
+		assert.GreaterOrEqual(t, d, want/2)
+		assert.LessOrEqual(t, d, want)
+	}
+}
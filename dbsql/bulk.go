@@ -0,0 +1,143 @@
+package dbsql
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"go.inout.gg/foundations/debug"
+)
+
+// UpsertOptions configures BulkUpsert.
+type UpsertOptions struct {
+	// Table is the name of the target table, optionally qualified with a schema.
+	Table string
+
+	// Columns are the columns of the copied rows.
+	Columns []string
+
+	// ConflictColumns are the columns of the unique constraint or index used
+	// to detect conflicts, such as the primary key.
+	ConflictColumns []string
+
+	// UpdateColumns are the columns updated on conflict. If empty,
+	// conflicting rows are skipped.
+	UpdateColumns []string
+
+	// Deduplicate keeps only the last copied row for each value of
+	// ConflictColumns. Otherwise duplicates fail the upsert, as a row cannot
+	// be updated twice by the same statement.
+	Deduplicate bool
+}
+
+// UpsertResult reports the outcome of BulkUpsert.
+type UpsertResult struct {
+	// Inserted is the number of inserted rows.
+	Inserted int64
+
+	// Updated is the number of updated rows.
+	Updated int64
+}
+
+// BulkUpsert upserts rows from src into a table.
+//
+// COPY cannot handle conflicts, so the rows are copied into a temporary
+// staging table first, and then moved into the target table with
+// INSERT ... SELECT ... ON CONFLICT. This is much faster than batched
+// INSERTs for large numbers of rows.
+//
+// Everything runs within a transaction started with WithTx, or within
+// a SAVEPOINT if db is already a transaction. It is not retried, as src
+// cannot be rewound.
+func BulkUpsert(ctx context.Context, db DBTX, opts UpsertOptions, src pgx.CopyFromSource) (UpsertResult, error) {
+	debug.Assert(opts.Table != "", "expected table to be defined")
+	debug.Assert(len(opts.Columns) > 0, "expected columns to be defined")
+	debug.Assert(len(opts.ConflictColumns) > 0, "expected conflict columns to be defined")
+
+	var result UpsertResult
+
+	table := pgx.Identifier(strings.Split(opts.Table, "."))
+	staging := pgx.Identifier{"bulk_upsert_" + strings.ToLower(rand.Text())}
+	columns := sanitizeIdentifiers(opts.Columns)
+	conflictColumns := sanitizeIdentifiers(opts.ConflictColumns)
+
+	err := WithTx(ctx, db, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		// Only the copied columns are created, without constraints, so that
+		// rows are validated once when moved into the target table.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+			staging.Sanitize(),
+			columns,
+			table.Sanitize(),
+		)); err != nil {
+			return fmt.Errorf("dbsql: failed to create staging table: %w", err)
+		}
+
+		if _, err := tx.CopyFrom(ctx, staging, opts.Columns, src); err != nil {
+			return fmt.Errorf("dbsql: failed to copy rows into staging table: %w", err)
+		}
+
+		sel := fmt.Sprintf("SELECT %s FROM %s", columns, staging.Sanitize())
+		if opts.Deduplicate {
+			// Rows of a freshly filled table are laid out in the order they
+			// were copied, so the greatest ctid is the last copied row.
+			sel = fmt.Sprintf(
+				"SELECT DISTINCT ON (%[2]s) %[1]s FROM %[3]s ORDER BY %[2]s, ctid DESC",
+				columns,
+				conflictColumns,
+				staging.Sanitize(),
+			)
+		}
+
+		action := "DO NOTHING"
+		if len(opts.UpdateColumns) > 0 {
+			set := make([]string, len(opts.UpdateColumns))
+			for i, c := range opts.UpdateColumns {
+				name := pgx.Identifier{c}.Sanitize()
+				set[i] = name + " = EXCLUDED." + name
+			}
+
+			action = "DO UPDATE SET " + strings.Join(set, ", ")
+		}
+
+		// xmax is zero for rows inserted by the statement, and set to
+		// the current transaction ID for updated ones.
+		if err := tx.QueryRow(ctx, fmt.Sprintf(`WITH upserted AS (
+	INSERT INTO %s (%s) %s
+	ON CONFLICT (%s) %s
+	RETURNING (xmax = 0) AS inserted
+)
+SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM upserted`,
+			table.Sanitize(),
+			columns,
+			sel,
+			conflictColumns,
+			action,
+		)).Scan(&result.Inserted, &result.Updated); err != nil {
+			return fmt.Errorf("dbsql: failed to upsert rows into %s: %w", table.Sanitize(), err)
+		}
+
+		if _, err := tx.Exec(ctx, "DROP TABLE "+staging.Sanitize()); err != nil {
+			return fmt.Errorf("dbsql: failed to drop staging table: %w", err)
+		}
+
+		return nil
+	}, WithTxMaxAttempts(1))
+	if err != nil {
+		return UpsertResult{}, err
+	}
+
+	return result, nil
+}
+
+func sanitizeIdentifiers(names []string) string {
+	sanitized := make([]string, len(names))
+	for i, name := range names {
+		sanitized[i] = pgx.Identifier{name}.Sanitize()
+	}
+
+	return strings.Join(sanitized, ", ")
+}
@@ -0,0 +1,140 @@
+package dbsql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/dbsql/dbsqltest"
+)
+
+// The test lives in an external package, as dbsqltest imports dbsql.
+
+const bulkSchema = `CREATE TABLE bulk_users (
+	email text PRIMARY KEY,
+	name text NOT NULL
+)`
+
+//nolint:gochecknoglobals
+var testDB = dbsqltest.New(&dbsqltest.Config{
+	Prefix:      "dbsql",
+	Fingerprint: bulkSchema,
+	Migrate: func(ctx context.Context, pool *pgxpool.Pool) error {
+		_, err := pool.Exec(ctx, bulkSchema)
+		return err //nolint:wrapcheck // wrapped by dbsqltest
+	},
+})
+
+func readNames(t *testing.T, pool *pgxpool.Pool) map[string]string {
+	t.Helper()
+
+	rows, err := pool.Query(context.Background(), "SELECT email, name FROM bulk_users")
+	require.NoError(t, err)
+
+	names := make(map[string]string)
+
+	var email, name string
+
+	_, err = pgx.ForEachRow(rows, []any{&email, &name}, func() error {
+		names[email] = name
+		return nil
+	})
+	require.NoError(t, err)
+
+	return names
+}
+
+func TestBulkUpsertDB(t *testing.T) {
+	ctx := context.Background()
+	opts := dbsql.UpsertOptions{
+		Table:           "bulk_users",
+		Columns:         []string{"email", "name"},
+		ConflictColumns: []string{"email"},
+		UpdateColumns:   []string{"name"},
+		Deduplicate:     false,
+	}
+
+	t.Run("it counts inserted and updated rows", func(t *testing.T) {
+		pool := testDB.Pool(t)
+
+		_, err := pool.Exec(ctx, "INSERT INTO bulk_users (email, name) VALUES ('a@example.com', 'A')")
+		require.NoError(t, err)
+
+		result, err := dbsql.BulkUpsert(ctx, pool, opts, pgx.CopyFromRows([][]any{
+			{"a@example.com", "Alice"},
+			{"b@example.com", "Bob"},
+			{"c@example.com", "Carol"},
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, dbsql.UpsertResult{Inserted: 2, Updated: 1}, result)
+		assert.Equal(t, map[string]string{
+			"a@example.com": "Alice",
+			"b@example.com": "Bob",
+			"c@example.com": "Carol",
+		}, readNames(t, pool))
+	})
+
+	t.Run("it skips conflicting rows without update columns", func(t *testing.T) {
+		pool := testDB.Pool(t)
+
+		_, err := pool.Exec(ctx, "INSERT INTO bulk_users (email, name) VALUES ('a@example.com', 'A')")
+		require.NoError(t, err)
+
+		opts := opts
+		opts.UpdateColumns = nil
+
+		result, err := dbsql.BulkUpsert(ctx, pool, opts, pgx.CopyFromRows([][]any{
+			{"a@example.com", "Alice"},
+			{"b@example.com", "Bob"},
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, dbsql.UpsertResult{Inserted: 1, Updated: 0}, result)
+		assert.Equal(t, map[string]string{"a@example.com": "A", "b@example.com": "Bob"}, readNames(t, pool))
+	})
+
+	t.Run("it keeps the last duplicate in a batch", func(t *testing.T) {
+		pool := testDB.Pool(t)
+
+		opts := opts
+		opts.Deduplicate = true
+
+		result, err := dbsql.BulkUpsert(ctx, pool, opts, pgx.CopyFromRows([][]any{
+			{"a@example.com", "A"},
+			{"b@example.com", "Bob"},
+			{"a@example.com", "Alice"},
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, dbsql.UpsertResult{Inserted: 2, Updated: 0}, result)
+		assert.Equal(t, map[string]string{"a@example.com": "Alice", "b@example.com": "Bob"}, readNames(t, pool))
+	})
+
+	t.Run("it fails on duplicates in a batch without deduplication", func(t *testing.T) {
+		pool := testDB.Pool(t)
+
+		_, err := dbsql.BulkUpsert(ctx, pool, opts, pgx.CopyFromRows([][]any{
+			{"a@example.com", "A"},
+			{"a@example.com", "Alice"},
+		}))
+		require.Error(t, err)
+		assert.Empty(t, readNames(t, pool))
+	})
+
+	t.Run("it joins the transaction of db", func(t *testing.T) {
+		pool := testDB.Pool(t)
+
+		tx, err := pool.Begin(ctx)
+		require.NoError(t, err)
+
+		result, err := dbsql.BulkUpsert(ctx, tx, opts, pgx.CopyFromRows([][]any{{"a@example.com", "Alice"}}))
+		require.NoError(t, err)
+		assert.Equal(t, dbsql.UpsertResult{Inserted: 1, Updated: 0}, result)
+
+		require.NoError(t, tx.Rollback(ctx))
+		assert.Empty(t, readNames(t, pool))
+	})
+}
@@ -0,0 +1,129 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countRow is a pgx.Row returning inserted and updated counts.
+type countRow struct{ inserted, updated int64 }
+
+func (r countRow) Scan(dest ...any) error {
+	*dest[0].(*int64) = r.inserted //nolint:forcetypeassert // the destination is known
+	*dest[1].(*int64) = r.updated  //nolint:forcetypeassert // the destination is known
+
+	return nil
+}
+
+// bulkTx records the statements of a bulk upsert.
+type bulkTx struct {
+	pgx.Tx
+
+	copyErr   error
+	copyTable pgx.Identifier
+	statement []string
+	copyCols  []string
+	committed bool
+}
+
+func (tx *bulkTx) Begin(context.Context) (pgx.Tx, error) { return tx, nil }
+func (tx *bulkTx) Rollback(context.Context) error        { return nil }
+
+func (tx *bulkTx) Commit(context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *bulkTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	tx.statement = append(tx.statement, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *bulkTx) CopyFrom(_ context.Context, table pgx.Identifier, cols []string, _ pgx.CopyFromSource) (int64, error) {
+	tx.copyTable = table
+	tx.copyCols = cols
+
+	return 3, tx.copyErr
+}
+
+func (tx *bulkTx) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	tx.statement = append(tx.statement, sql)
+	return countRow{inserted: 2, updated: 1}
+}
+
+func TestBulkUpsert(t *testing.T) {
+	ctx := context.Background()
+	rows := pgx.CopyFromRows([][]any{{1, "a"}, {2, "b"}, {3, "c"}})
+	staging := regexp.MustCompile(`"bulk_upsert_[a-z0-9]+"`)
+
+	t.Run("it upserts through a staging table", func(t *testing.T) {
+		tx := &bulkTx{}
+
+		result, err := BulkUpsert(ctx, tx, UpsertOptions{
+			Table:           "app.users",
+			Columns:         []string{"id", "name"},
+			ConflictColumns: []string{"id"},
+			UpdateColumns:   []string{"name"},
+		}, rows)
+		require.NoError(t, err)
+		assert.Equal(t, UpsertResult{Inserted: 2, Updated: 1}, result)
+		assert.True(t, tx.committed)
+
+		require.Len(t, tx.copyTable, 1)
+		assert.Regexp(t, `^bulk_upsert_`, tx.copyTable[0])
+		assert.Equal(t, []string{"id", "name"}, tx.copyCols)
+
+		require.Len(t, tx.statement, 3)
+		assert.Equal(t,
+			`CREATE TEMPORARY TABLE "staging" ON COMMIT DROP AS SELECT "id", "name" FROM "app"."users" WITH NO DATA`,
+			staging.ReplaceAllString(tx.statement[0], `"staging"`),
+		)
+		assert.Equal(t, `WITH upserted AS (
+	INSERT INTO "app"."users" ("id", "name") SELECT "id", "name" FROM "staging"
+	ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"
+	RETURNING (xmax = 0) AS inserted
+)
+SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM upserted`,
+			staging.ReplaceAllString(tx.statement[1], `"staging"`),
+		)
+		assert.Equal(t, `DROP TABLE "staging"`, staging.ReplaceAllString(tx.statement[2], `"staging"`))
+	})
+
+	t.Run("it skips conflicts and deduplicates", func(t *testing.T) {
+		tx := &bulkTx{}
+
+		_, err := BulkUpsert(ctx, tx, UpsertOptions{
+			Table:           "users",
+			Columns:         []string{"id", "name"},
+			ConflictColumns: []string{"id"},
+			Deduplicate:     true,
+		}, rows)
+		require.NoError(t, err)
+		assert.Contains(
+			t,
+			staging.ReplaceAllString(tx.statement[1], `"staging"`),
+			`SELECT DISTINCT ON ("id") "id", "name" FROM "staging" ORDER BY "id", ctid DESC
+	ON CONFLICT ("id") DO NOTHING`,
+		)
+	})
+
+	t.Run("it rolls back on copy failure", func(t *testing.T) {
+		errCopy := errors.New("copy failed")
+		tx := &bulkTx{copyErr: errCopy}
+
+		_, err := BulkUpsert(ctx, tx, UpsertOptions{
+			Table:           "users",
+			Columns:         []string{"id"},
+			ConflictColumns: []string{"id"},
+		}, rows)
+		require.ErrorIs(t, err, errCopy)
+		assert.False(t, tx.committed)
+	})
+}
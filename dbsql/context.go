@@ -4,14 +4,24 @@ import (
 	"context"
 	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ctxKey struct{}
 
-var kCtxKey = ctxKey{} //nolint:gochecknoglobals
+type txCtxKey struct{}
 
-var ErrPoolMissing = errors.New("dbsql: failed to retrieve db pool from context")
+//nolint:gochecknoglobals
+var (
+	kCtxKey   = ctxKey{}
+	kTxCtxKey = txCtxKey{}
+)
+
+var (
+	ErrPoolMissing = errors.New("dbsql: failed to retrieve db pool from context")
+	ErrTxMissing   = errors.New("dbsql: no active transaction in context")
+)
 
 // WithPool returns a new context with the given pool.
 func WithPool(ctx context.Context, pool *pgxpool.Pool) context.Context {
@@ -26,3 +36,43 @@ func FromContext(ctx context.Context) (*pgxpool.Pool, error) {
 
 	return nil, ErrPoolMissing
 }
+
+// WithActiveTx returns a new context with the given active transaction.
+//
+// WithTx does this automatically for the context passed to its callback.
+func WithActiveTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, kTxCtxKey, tx)
+}
+
+// TxFromContext returns the active transaction associated with the given context.
+//
+// If there is no active transaction, ErrTxMissing is returned.
+func TxFromContext(ctx context.Context) (pgx.Tx, error) {
+	if tx, ok := ctx.Value(kTxCtxKey).(pgx.Tx); ok {
+		return tx, nil
+	}
+
+	return nil, ErrTxMissing
+}
+
+// RequireTx returns ErrTxMissing if the given context has no active transaction.
+//
+// It is useful for repository functions that must not run outside of
+// a transaction.
+func RequireTx(ctx context.Context) error {
+	_, err := TxFromContext(ctx)
+	return err
+}
+
+// DBTXFromContext returns the active transaction associated with the given
+// context, or the pool if there is no active transaction.
+//
+// It allows repository functions to transparently join the current
+// transaction.
+func DBTXFromContext(ctx context.Context) (DBTX, error) {
+	if tx, err := TxFromContext(ctx); err == nil {
+		return tx, nil
+	}
+
+	return FromContext(ctx)
+}
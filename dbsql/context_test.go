@@ -0,0 +1,36 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxFromContext(t *testing.T) {
+	t.Run("no transaction", func(t *testing.T) {
+		ctx := context.Background()
+
+		_, err := TxFromContext(ctx)
+		require.ErrorIs(t, err, ErrTxMissing)
+		require.ErrorIs(t, RequireTx(ctx), ErrTxMissing)
+
+		_, err = DBTXFromContext(ctx)
+		require.ErrorIs(t, err, ErrPoolMissing)
+	})
+
+	t.Run("active transaction", func(t *testing.T) {
+		tx := &fakeTx{Tx: nil, db: &fakeDB{}}
+		ctx := WithActiveTx(context.Background(), tx)
+
+		got, err := TxFromContext(ctx)
+		require.NoError(t, err)
+		assert.Same(t, tx, got)
+		require.NoError(t, RequireTx(ctx))
+
+		db, err := DBTXFromContext(ctx)
+		require.NoError(t, err)
+		assert.Same(t, tx, db)
+	})
+}
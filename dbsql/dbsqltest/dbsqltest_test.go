@@ -0,0 +1,63 @@
+package dbsqltest
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	migrations := fstest.MapFS{
+		"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id int);")},
+	}
+
+	fingerprint := func(config *Config) string {
+		f, err := New(config).fingerprint()
+		require.NoError(t, err)
+
+		return f
+	}
+
+	base := fingerprint(&Config{Migrations: migrations})
+	assert.Len(t, base, 12)
+	assert.Equal(t, base, fingerprint(&Config{Migrations: migrations}))
+	assert.NotEqual(t, base, fingerprint(&Config{Migrations: migrations, Fingerprint: "v2"}))
+
+	migrations["0002_create_orders.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE orders (id int);")}
+	assert.NotEqual(t, base, fingerprint(&Config{Migrations: migrations}))
+}
+
+func TestDB(t *testing.T) {
+	db := New(&Config{
+		Migrations: fstest.MapFS{
+			"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id int PRIMARY KEY);")},
+		},
+	})
+
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+	t.Run("pools are isolated", func(t *testing.T) {
+		p1, p2 := db.Pool(t), db.Pool(t)
+
+		_, err := p1.Exec(context.Background(), "INSERT INTO users (id) VALUES (1)")
+		require.NoError(t, err)
+
+		var count int
+		require.NoError(t, p2.QueryRow(context.Background(), "SELECT count(*) FROM users").Scan(&count))
+		assert.Zero(t, count)
+	})
+
+	t.Run("transactions are rolled back", func(t *testing.T) {
+		t.Run("insert", func(t *testing.T) {
+			_, err := db.Tx(t).Exec(context.Background(), "INSERT INTO users (id) VALUES (1)")
+			require.NoError(t, err)
+		})
+
+		var count int
+		require.NoError(t, db.Tx(t).QueryRow(context.Background(), "SELECT count(*) FROM users").Scan(&count))
+		assert.Zero(t, count)
+	})
+}
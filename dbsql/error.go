@@ -1,7 +1,11 @@
 package dbsql
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -9,9 +13,237 @@ import (
 )
 
 const (
-	ErrCodeUniqueViolation = "23505"
+	ErrCodeClassConnectionException = "08"
+	ErrCodeNotNullViolation         = "23502"
+	ErrCodeForeignKeyViolation      = "23503"
+	ErrCodeUniqueViolation          = "23505"
+	ErrCodeCheckViolation           = "23514"
+	ErrCodeReadOnlySQLTransaction   = "25006"
+	ErrCodeIdleInTransactionTimeout = "25P03"
+	ErrCodeSerializationFailure     = "40001"
+	ErrCodeDeadlockDetected         = "40P01"
+	ErrCodeTooManyConnections       = "53300"
+	ErrCodeLockNotAvailable         = "55P03"
+	ErrCodeQueryCanceled            = "57014"
+	ErrCodeAdminShutdown            = "57P01"
+	ErrCodeCrashShutdown            = "57P02"
+	ErrCodeCannotConnectNow         = "57P03"
 )
 
+// statementTimeoutMessage distinguishes statement timeouts from cancellation
+// requests, both reported with ErrCodeQueryCanceled.
+//
+// The message is translated according to the server lc_messages setting,
+// so with a non-English locale statement timeouts are classified as
+// ClassQueryCanceled.
+const statementTimeoutMessage = "canceling statement due to statement timeout"
+
+// ErrorClass is a class of database errors.
+type ErrorClass int
+
+const (
+	ClassUnknown ErrorClass = iota
+	ClassNoRows
+	ClassPoolClosed
+	ClassUniqueViolation
+	ClassForeignKeyViolation
+	ClassCheckViolation
+	ClassNotNullViolation
+	ClassSerializationFailure
+	ClassDeadlock
+	ClassLockTimeout
+	// ClassStatementTimeout is only reported for servers with English
+	// lc_messages, see ClassQueryCanceled.
+	ClassStatementTimeout
+	// ClassQueryCanceled is reported for cancellation requests, and for
+	// statement timeouts of servers with non-English lc_messages, as
+	// Postgres reports both with the same code.
+	ClassQueryCanceled
+	ClassDeadlineExceeded
+	ClassReadOnlyTransaction
+	ClassConnectionFailure
+	ClassTooManyConnections
+)
+
+//nolint:gochecknoglobals
+var errorClassNames = [...]string{
+	ClassUnknown:              "unknown",
+	ClassNoRows:               "no rows",
+	ClassPoolClosed:           "pool closed",
+	ClassUniqueViolation:      "unique violation",
+	ClassForeignKeyViolation:  "foreign key violation",
+	ClassCheckViolation:       "check violation",
+	ClassNotNullViolation:     "not null violation",
+	ClassSerializationFailure: "serialization failure",
+	ClassDeadlock:             "deadlock",
+	ClassLockTimeout:          "lock timeout",
+	ClassStatementTimeout:     "statement timeout",
+	ClassQueryCanceled:        "query canceled",
+	ClassDeadlineExceeded:     "deadline exceeded",
+	ClassReadOnlyTransaction:  "read-only transaction",
+	ClassConnectionFailure:    "connection failure",
+	ClassTooManyConnections:   "too many connections",
+}
+
+func (c ErrorClass) String() string {
+	if c < 0 || int(c) >= len(errorClassNames) {
+		return errorClassNames[ClassUnknown]
+	}
+
+	return errorClassNames[c]
+}
+
+// Error is a classified database error.
+type Error struct {
+	// Err is the original error.
+	Err error
+
+	// Code is the SQLSTATE code, it is empty for errors not reported by
+	// the server.
+	Code string
+
+	// Schema, Table, Column and Constraint are names of the database
+	// objects associated with the error, if reported by the server.
+	Schema     string
+	Table      string
+	Column     string
+	Constraint string
+
+	// Class is the class of the error.
+	Class ErrorClass
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Retryable reports whether the operation that failed with the error may
+// succeed if it is retried, e.g. the whole transaction in case of
+// a serialization failure.
+//
+// Connection failures are only retryable if the connection failed before
+// anything was sent to the server, as a non-idempotent statement may have
+// been executed otherwise.
+func (e *Error) Retryable() bool {
+	switch e.Class { //nolint:exhaustive // the rest is not retryable
+	case ClassSerializationFailure,
+		ClassDeadlock,
+		ClassLockTimeout,
+		ClassTooManyConnections:
+		return true
+	case ClassConnectionFailure:
+		var connectErr *pgconn.ConnectError
+		return errors.As(e.Err, &connectErr) || pgconn.SafeToRetry(e.Err)
+	default:
+		return false
+	}
+}
+
+// ClassifyError classifies the error err.
+//
+// It returns nil if err is nil. Errors that cannot be classified have
+// the ClassUnknown class.
+func ClassifyError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	//nolint:exhaustruct
+	e := &Error{Err: err, Class: ClassUnknown}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		e.Code = pgErr.Code
+		e.Schema = pgErr.SchemaName
+		e.Table = pgErr.TableName
+		e.Column = pgErr.ColumnName
+		e.Constraint = pgErr.ConstraintName
+		e.Class = classifyPgError(pgErr)
+
+		return e
+	}
+
+	var (
+		connectErr *pgconn.ConnectError
+		netErr     net.Error
+	)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		e.Class = ClassNoRows
+	case errors.Is(err, puddle.ErrClosedPool):
+		e.Class = ClassPoolClosed
+	case errors.Is(err, context.Canceled):
+		e.Class = ClassQueryCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Class = ClassDeadlineExceeded
+	case errors.As(err, &connectErr),
+		errors.As(err, &netErr),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		pgconn.SafeToRetry(err):
+		e.Class = ClassConnectionFailure
+	}
+
+	return e
+}
+
+func classifyPgError(err *pgconn.PgError) ErrorClass {
+	switch err.Code {
+	case ErrCodeUniqueViolation:
+		return ClassUniqueViolation
+	case ErrCodeForeignKeyViolation:
+		return ClassForeignKeyViolation
+	case ErrCodeCheckViolation:
+		return ClassCheckViolation
+	case ErrCodeNotNullViolation:
+		return ClassNotNullViolation
+	case ErrCodeSerializationFailure:
+		return ClassSerializationFailure
+	case ErrCodeDeadlockDetected:
+		return ClassDeadlock
+	case ErrCodeLockNotAvailable:
+		return ClassLockTimeout
+	case ErrCodeQueryCanceled:
+		// Postgres reports both statement timeouts and cancellation
+		// requests with the same code.
+		if strings.HasPrefix(err.Message, statementTimeoutMessage) {
+			return ClassStatementTimeout
+		}
+
+		return ClassQueryCanceled
+	case ErrCodeReadOnlySQLTransaction:
+		return ClassReadOnlyTransaction
+	case ErrCodeTooManyConnections:
+		return ClassTooManyConnections
+	case ErrCodeAdminShutdown, ErrCodeCrashShutdown, ErrCodeCannotConnectNow, ErrCodeIdleInTransactionTimeout:
+		return ClassConnectionFailure
+	}
+
+	if strings.HasPrefix(err.Code, ErrCodeClassConnectionException) {
+		return ClassConnectionFailure
+	}
+
+	return ClassUnknown
+}
+
+// IsErrorClass returns true if the error is of the given class.
+func IsErrorClass(err error, class ErrorClass) bool {
+	if err == nil {
+		return false
+	}
+
+	return ClassifyError(err).Class == class
+}
+
+// IsRetryableError returns true if the failed operation may succeed if retried.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return ClassifyError(err).Retryable()
+}
+
 // IsUniqueViolationError returns true if the error is a unique violation error.
 func IsUniqueViolationError(err error) bool {
 	var pgxErr *pgconn.PgError
@@ -22,6 +254,21 @@ func IsUniqueViolationError(err error) bool {
 	return false
 }
 
+// IsForeignKeyViolationError returns true if the error is a foreign key violation error.
+func IsForeignKeyViolationError(err error) bool {
+	return IsErrorClass(err, ClassForeignKeyViolation)
+}
+
+// IsCheckViolationError returns true if the error is a check constraint violation error.
+func IsCheckViolationError(err error) bool {
+	return IsErrorClass(err, ClassCheckViolation)
+}
+
+// IsNotNullViolationError returns true if the error is a not-null constraint violation error.
+func IsNotNullViolationError(err error) bool {
+	return IsErrorClass(err, ClassNotNullViolation)
+}
+
 // IsNotFoundError returns true if the error is a pgx no rows error.
 func IsNotFoundError(err error) bool {
 	return errors.Is(err, pgx.ErrNoRows)
@@ -0,0 +1,154 @@
+package dbsql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// safeToRetryError is an error that occurred before sending anything to the server.
+type safeToRetryError struct{ error }
+
+func (safeToRetryError) SafeToRetry() bool { return true }
+func (e safeToRetryError) Unwrap() error   { return e.error }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err       error
+		name      string
+		class     ErrorClass
+		retryable bool
+	}{
+		{
+			name:  "unique violation",
+			err:   &pgconn.PgError{Code: ErrCodeUniqueViolation},
+			class: ClassUniqueViolation,
+		},
+		{
+			name:  "foreign key violation",
+			err:   &pgconn.PgError{Code: ErrCodeForeignKeyViolation},
+			class: ClassForeignKeyViolation,
+		},
+		{
+			name:  "check violation",
+			err:   &pgconn.PgError{Code: ErrCodeCheckViolation},
+			class: ClassCheckViolation,
+		},
+		{
+			name:  "not null violation",
+			err:   &pgconn.PgError{Code: ErrCodeNotNullViolation},
+			class: ClassNotNullViolation,
+		},
+		{
+			name:      "serialization failure",
+			err:       &pgconn.PgError{Code: ErrCodeSerializationFailure},
+			class:     ClassSerializationFailure,
+			retryable: true,
+		},
+		{
+			name:      "deadlock",
+			err:       &pgconn.PgError{Code: ErrCodeDeadlockDetected},
+			class:     ClassDeadlock,
+			retryable: true,
+		},
+		{
+			name:      "lock not available",
+			err:       &pgconn.PgError{Code: ErrCodeLockNotAvailable},
+			class:     ClassLockTimeout,
+			retryable: true,
+		},
+		{
+			name:  "statement timeout",
+			err:   &pgconn.PgError{Code: ErrCodeQueryCanceled, Message: statementTimeoutMessage},
+			class: ClassStatementTimeout,
+		},
+		{
+			name:  "query canceled",
+			err:   &pgconn.PgError{Code: ErrCodeQueryCanceled, Message: "canceling statement due to user request"},
+			class: ClassQueryCanceled,
+		},
+		{
+			name:  "read-only transaction",
+			err:   &pgconn.PgError{Code: ErrCodeReadOnlySQLTransaction},
+			class: ClassReadOnlyTransaction,
+		},
+		{
+			name:  "connection exception",
+			err:   &pgconn.PgError{Code: "08006"},
+			class: ClassConnectionFailure,
+		},
+		{
+			name:  "admin shutdown",
+			err:   &pgconn.PgError{Code: ErrCodeAdminShutdown},
+			class: ClassConnectionFailure,
+		},
+		{
+			name:      "too many connections",
+			err:       &pgconn.PgError{Code: ErrCodeTooManyConnections},
+			class:     ClassTooManyConnections,
+			retryable: true,
+		},
+		{
+			name:  "unexpected EOF",
+			err:   fmt.Errorf("read: %w", io.ErrUnexpectedEOF),
+			class: ClassConnectionFailure,
+		},
+		{
+			name:      "connection failed before sending",
+			err:       safeToRetryError{io.ErrUnexpectedEOF},
+			class:     ClassConnectionFailure,
+			retryable: true,
+		},
+		{
+			name:      "connect error",
+			err:       &pgconn.ConnectError{},
+			class:     ClassConnectionFailure,
+			retryable: true,
+		},
+		{name: "no rows", err: pgx.ErrNoRows, class: ClassNoRows},
+		{name: "pool closed", err: puddle.ErrClosedPool, class: ClassPoolClosed},
+		{name: "context canceled", err: context.Canceled, class: ClassQueryCanceled},
+		{name: "context deadline exceeded", err: context.DeadlineExceeded, class: ClassDeadlineExceeded},
+		{name: "unknown", err: &pgconn.PgError{Code: "42601"}, class: ClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyError(fmt.Errorf("wrapped: %w", tt.err))
+			require.NotNil(t, err)
+			assert.Equal(t, tt.class, err.Class, "expected %s, got %s", tt.class, err.Class)
+			assert.Equal(t, tt.retryable, err.Retryable())
+			assert.Equal(t, tt.retryable, IsRetryableError(tt.err))
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("it exposes object names", func(t *testing.T) {
+		err := ClassifyError(&pgconn.PgError{
+			Code:           ErrCodeForeignKeyViolation,
+			SchemaName:     "public",
+			TableName:      "orders",
+			ColumnName:     "user_id",
+			ConstraintName: "orders_user_id_fkey",
+		})
+
+		assert.Equal(t, ErrCodeForeignKeyViolation, err.Code)
+		assert.Equal(t, "public", err.Schema)
+		assert.Equal(t, "orders", err.Table)
+		assert.Equal(t, "user_id", err.Column)
+		assert.Equal(t, "orders_user_id_fkey", err.Constraint)
+		assert.True(t, IsForeignKeyViolationError(err))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Nil(t, ClassifyError(nil))
+		assert.False(t, IsRetryableError(nil))
+	})
+}
@@ -0,0 +1,265 @@
+// Package jobqueue implements a background job queue on top of dbsql.
+//
+// Jobs are enqueued with Client.Enqueue, usually within the transaction that
+// makes them necessary, and are run by a Processor with registered workers.
+// Jobs are fetched with FOR UPDATE SKIP LOCKED, so several replicas may run
+// a Processor concurrently. A job is run at least once, workers must be
+// idempotent.
+package jobqueue
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+)
+
+const (
+	// DefaultTable is the default name of the jobs table.
+	DefaultTable = "jobs"
+
+	// DefaultQueue is the queue jobs are enqueued to by default.
+	DefaultQueue = "default"
+
+	// DefaultMaxAttempts is the default maximum number of attempts of a job.
+	DefaultMaxAttempts = 25
+)
+
+// ErrDuplicateJob is returned by Enqueue when a unique job with the same
+// unique key is already waiting or running.
+var ErrDuplicateJob = errors.New("jobqueue: duplicate unique job")
+
+// JobArgs are the arguments of a job, encoded as JSON.
+//
+// Kind identifies the worker running the job, it must be stable across
+// deploys as it is stored with the job.
+type JobArgs interface {
+	Kind() string
+}
+
+// Job is a job being run by a worker.
+type Job[T JobArgs] struct {
+	CreatedAt   time.Time
+	RunAt       time.Time
+	Args        T
+	Queue       string
+	Kind        string
+	ID          int64
+	Attempt     int
+	MaxAttempts int
+	Priority    int
+}
+
+// Worker runs jobs with arguments of type T.
+type Worker[T JobArgs] interface {
+	Work(context.Context, *Job[T]) error
+}
+
+// WorkerFunc is an adapter to allow the use of ordinary functions as workers.
+type WorkerFunc[T JobArgs] func(context.Context, *Job[T]) error
+
+func (f WorkerFunc[T]) Work(ctx context.Context, job *Job[T]) error { return f(ctx, job) }
+
+// EnqueueOptions configures an enqueued job.
+type EnqueueOptions struct {
+	// RunAt is the earliest time the job is run at, defaults to now.
+	RunAt time.Time
+
+	// Queue is the queue of the job, defaults to DefaultQueue.
+	Queue string
+
+	// UniqueKey makes the job unique among waiting and running jobs of
+	// the same kind with the same key.
+	UniqueKey string
+
+	// Priority is the priority of the job within its queue,
+	// jobs with higher priority run first.
+	Priority int
+
+	// MaxAttempts is the maximum number of attempts of the job,
+	// defaults to DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Unique makes the job unique by its arguments, unless UniqueKey is set.
+	Unique bool
+}
+
+// Client enqueues jobs and holds the registered workers.
+type Client struct {
+	workers map[string]workFunc
+	table   string
+	ident   pgx.Identifier
+	mu      sync.RWMutex
+}
+
+// workFunc decodes a job row and runs the registered worker.
+type workFunc func(context.Context, *row) error
+
+// row is a fetched job with undecoded arguments.
+type row struct {
+	CreatedAt   time.Time
+	RunAt       time.Time
+	Queue       string
+	Kind        string
+	Args        json.RawMessage
+	ID          int64
+	Attempt     int
+	MaxAttempts int
+	Priority    int
+}
+
+// New creates a new Client for jobs stored in table, optionally qualified
+// with a schema. If table is empty, DefaultTable is used.
+func New(table string) *Client {
+	ident := pgx.Identifier(strings.Split(cmp.Or(table, DefaultTable), "."))
+
+	//nolint:exhaustruct
+	return &Client{
+		workers: make(map[string]workFunc),
+		table:   ident.Sanitize(),
+		ident:   ident,
+	}
+}
+
+// Schema returns the DDL creating the jobs table, it is meant to be included
+// into the service's migrations.
+func (c *Client) Schema() string {
+	index := func(suffix string) string {
+		return pgx.Identifier{strings.Join(c.ident, "_") + suffix}.Sanitize()
+	}
+
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id bigserial PRIMARY KEY,
+	queue text NOT NULL,
+	kind text NOT NULL,
+	args jsonb NOT NULL,
+	priority integer NOT NULL DEFAULT 0,
+	state text NOT NULL DEFAULT 'available',
+	attempt integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	unique_key text,
+	last_error text,
+	run_at timestamptz NOT NULL DEFAULT now(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	attempted_at timestamptz,
+	finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (queue, priority DESC, run_at, id)
+	WHERE state = 'available';
+
+CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (attempted_at)
+	WHERE state = 'running';
+
+CREATE UNIQUE INDEX IF NOT EXISTS %[4]s ON %[1]s (kind, unique_key)
+	WHERE unique_key IS NOT NULL AND state IN ('available', 'running');
+`, c.table, index("_fetch_idx"), index("_running_idx"), index("_unique_idx"))
+}
+
+// Register registers w to run jobs with arguments of type T.
+func Register[T JobArgs](c *Client, w Worker[T]) {
+	var zero T
+
+	kind := zero.Kind()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	debug.Assert(c.workers[kind] == nil, "expected worker for %q to be registered once", kind)
+
+	c.workers[kind] = func(ctx context.Context, r *row) error {
+		var args T
+		if err := json.Unmarshal(r.Args, &args); err != nil {
+			return fmt.Errorf("jobqueue: failed to decode arguments of %q job: %w", kind, err)
+		}
+
+		return w.Work(ctx, &Job[T]{
+			CreatedAt:   r.CreatedAt,
+			RunAt:       r.RunAt,
+			Args:        args,
+			Queue:       r.Queue,
+			Kind:        r.Kind,
+			ID:          r.ID,
+			Attempt:     r.Attempt,
+			MaxAttempts: r.MaxAttempts,
+			Priority:    r.Priority,
+		})
+	}
+}
+
+func (c *Client) worker(kind string) (workFunc, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	w, ok := c.workers[kind]
+
+	return w, ok
+}
+
+// Enqueue enqueues a job with args using db, which is typically
+// a transaction, and returns the job ID.
+//
+// If the job is unique and a job with the same key is already waiting
+// or running, ErrDuplicateJob is returned.
+func (c *Client) Enqueue(ctx context.Context, db dbsql.DBTX, args JobArgs, opts *EnqueueOptions) (int64, error) {
+	if opts == nil {
+		//nolint:exhaustruct
+		opts = &EnqueueOptions{}
+	}
+
+	b, err := json.Marshal(args)
+	if err != nil {
+		return 0, fmt.Errorf("jobqueue: failed to encode arguments of %q job: %w", args.Kind(), err)
+	}
+
+	var uniqueKey *string
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	} else if opts.Unique {
+		sum := sha256.Sum256(b)
+		key := hex.EncodeToString(sum[:])
+		uniqueKey = &key
+	}
+
+	var runAt *time.Time
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+
+	var id int64
+
+	err = db.QueryRow(
+		ctx,
+		fmt.Sprintf(`INSERT INTO %s (queue, kind, args, priority, max_attempts, unique_key, run_at)
+VALUES ($1, $2, $3, $4, $5, $6, coalesce($7, now()))
+ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND state IN ('available', 'running') DO NOTHING
+RETURNING id`, c.table),
+		cmp.Or(opts.Queue, DefaultQueue),
+		args.Kind(),
+		b,
+		opts.Priority,
+		cmp.Or(opts.MaxAttempts, DefaultMaxAttempts),
+		uniqueKey,
+		runAt,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateJob, args.Kind())
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("jobqueue: failed to enqueue %q job: %w", args.Kind(), err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,214 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/dbsql"
+)
+
+type emailArgs struct {
+	To string `json:"to"`
+}
+
+func (emailArgs) Kind() string { return "email" }
+
+// idRow is a pgx.Row returning a job ID.
+type idRow struct {
+	err error
+	id  int64
+}
+
+func (r idRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	*dest[0].(*int64) = r.id //nolint:forcetypeassert // the destination is known
+
+	return nil
+}
+
+// insertDB records the inserted job.
+type insertDB struct {
+	dbsql.DBTX
+
+	err  error
+	args []any
+}
+
+func (db *insertDB) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	db.args = args
+	return idRow{id: 1, err: db.err}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("schema", func(t *testing.T) {
+		schema := New("queue.jobs").Schema()
+		assert.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "queue"."jobs"`)
+		assert.Contains(t, schema, `CREATE UNIQUE INDEX IF NOT EXISTS "queue_jobs_unique_idx" ON "queue"."jobs"`)
+	})
+
+	t.Run("enqueue with defaults", func(t *testing.T) {
+		db := &insertDB{}
+
+		id, err := New("").Enqueue(ctx, db, emailArgs{To: "a@example.com"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), id)
+		assert.Equal(t, []any{
+			DefaultQueue,
+			"email",
+			[]byte(`{"to":"a@example.com"}`),
+			0,
+			DefaultMaxAttempts,
+			(*string)(nil),
+			(*time.Time)(nil),
+		}, db.args)
+	})
+
+	t.Run("enqueue with options", func(t *testing.T) {
+		db := &insertDB{}
+		runAt := time.Now().Add(time.Hour)
+		key := "welcome"
+
+		_, err := New("").Enqueue(ctx, db, emailArgs{To: "a@example.com"}, &EnqueueOptions{
+			RunAt:       runAt,
+			Queue:       "mail",
+			UniqueKey:   key,
+			Priority:    10,
+			MaxAttempts: 3,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []any{"mail", "email", []byte(`{"to":"a@example.com"}`), 10, 3, &key, &runAt}, db.args)
+	})
+
+	t.Run("enqueue unique by arguments", func(t *testing.T) {
+		db := &insertDB{}
+
+		_, err := New("").Enqueue(ctx, db, emailArgs{To: "a@example.com"}, &EnqueueOptions{Unique: true})
+		require.NoError(t, err)
+		key1 := db.args[5].(*string) //nolint:forcetypeassert // the unique key is a *string
+
+		_, err = New("").Enqueue(ctx, db, emailArgs{To: "b@example.com"}, &EnqueueOptions{Unique: true})
+		require.NoError(t, err)
+		key2 := db.args[5].(*string) //nolint:forcetypeassert // the unique key is a *string
+
+		assert.NotEqual(t, *key1, *key2)
+	})
+
+	t.Run("enqueue duplicate", func(t *testing.T) {
+		db := &insertDB{err: pgx.ErrNoRows}
+
+		_, err := New("").Enqueue(ctx, db, emailArgs{}, &EnqueueOptions{Unique: true})
+		require.ErrorIs(t, err, ErrDuplicateJob)
+	})
+}
+
+func TestProcessor(t *testing.T) {
+	ctx := context.Background()
+
+	// The pool connects lazily, so it can be created for an unreachable database.
+	pool, err := pgxpool.New(ctx, "postgres://localhost:1/test?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	t.Run("it runs registered workers", func(t *testing.T) {
+		c := New("")
+
+		var job *Job[emailArgs]
+
+		Register(c, WorkerFunc[emailArgs](func(_ context.Context, j *Job[emailArgs]) error {
+			job = j
+			return nil
+		}))
+
+		p := c.NewProcessor(pool, nil)
+
+		err := p.work(ctx, &row{ID: 1, Kind: "email", Args: json.RawMessage(`{"to":"a@example.com"}`), Attempt: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), job.ID)
+		assert.Equal(t, 2, job.Attempt)
+		assert.Equal(t, emailArgs{To: "a@example.com"}, job.Args)
+	})
+
+	t.Run("it fails jobs without worker", func(t *testing.T) {
+		p := New("").NewProcessor(pool, nil)
+
+		require.Error(t, p.work(ctx, &row{Kind: "email", Args: json.RawMessage(`{}`)}))
+	})
+
+	t.Run("it recovers panicking workers", func(t *testing.T) {
+		c := New("")
+		Register(c, WorkerFunc[emailArgs](func(context.Context, *Job[emailArgs]) error { panic("boom") }))
+
+		err := c.NewProcessor(pool, nil).work(ctx, &row{Kind: "email", Args: json.RawMessage(`{}`)})
+		require.ErrorContains(t, err, "boom")
+	})
+
+	t.Run("it times out jobs", func(t *testing.T) {
+		c := New("")
+		Register(c, WorkerFunc[emailArgs](func(ctx context.Context, _ *Job[emailArgs]) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+
+		p := c.NewProcessor(pool, &ProcessorConfig{JobTimeout: time.Millisecond})
+
+		err := p.work(ctx, &row{Kind: "email", Args: json.RawMessage(`{}`)})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("it stops while failing to fetch", func(t *testing.T) {
+		p := New("").NewProcessor(pool, &ProcessorConfig{PollInterval: time.Millisecond})
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- p.Start(ctx) }()
+
+		time.Sleep(10 * time.Millisecond)
+
+		stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		require.NoError(t, p.Stop(stopCtx))
+		require.NoError(t, <-errCh)
+	})
+}
+
+func TestProcessorConfigDefaults(t *testing.T) {
+	t.Run("jobs time out before they are rescued", func(t *testing.T) {
+		//nolint:exhaustruct
+		c := &ProcessorConfig{}
+		c.defaults()
+
+		assert.Equal(t, DefaultJobTimeout, c.JobTimeout)
+		assert.Equal(t, DefaultRescueAfter, c.RescueAfter)
+	})
+
+	t.Run("rescue waits for long jobs", func(t *testing.T) {
+		//nolint:exhaustruct
+		c := &ProcessorConfig{JobTimeout: 2 * time.Hour}
+		c.defaults()
+
+		assert.Equal(t, 4*time.Hour, c.RescueAfter)
+	})
+}
+
+func TestProcessorConfigBackoff(t *testing.T) {
+	//nolint:exhaustruct
+	c := &ProcessorConfig{MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: time.Minute} {
+		d := c.backoff(attempt)
+		assert.GreaterOrEqual(t, d, want/2)
+		assert.LessOrEqual(t, d, want)
+	}
+}
@@ -0,0 +1,411 @@
+package jobqueue
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/startstop"
+)
+
+var _ startstop.Starter = (*Processor)(nil)
+
+// errAbandoned is recorded as the last error of rescued jobs.
+var errAbandoned = errors.New("jobqueue: job abandoned by its processor")
+
+// attemptRunning matches a job still running the attempt given as $2.
+const attemptRunning = "state = 'running' AND attempt = $2"
+
+const (
+	DefaultConcurrency  = 10
+	DefaultPollInterval = time.Second
+	DefaultMinBackoff   = time.Second
+	DefaultMaxBackoff   = 24 * time.Hour
+	DefaultJobTimeout   = 30 * time.Minute
+	DefaultRescueAfter  = time.Hour
+)
+
+// ProcessorConfig configures a Processor.
+type ProcessorConfig struct {
+	// Logger is used to log job failures.
+	Logger *slog.Logger
+
+	// Queues maps the queues to process to their concurrency,
+	// defaults to DefaultQueue with DefaultConcurrency.
+	Queues map[string]int
+
+	// PollInterval is the interval between polls of an empty queue.
+	PollInterval time.Duration
+
+	// MinBackoff is the base delay before the second attempt of a failed job.
+	// The base delay doubles with each subsequent attempt, and the actual
+	// delay is picked at random from its upper half, see dbsql.Backoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between attempts of a failed job.
+	MaxBackoff time.Duration
+
+	// JobTimeout is the maximum duration of a single attempt,
+	// defaults to DefaultJobTimeout.
+	JobTimeout time.Duration
+
+	// RescueAfter is how long a job may be running before it is considered
+	// abandoned by a crashed processor and made available again, or
+	// discarded if it has exhausted its attempts. It must be greater than
+	// JobTimeout, so that running jobs are never rescued, and defaults to
+	// DefaultRescueAfter or twice JobTimeout, whichever is greater.
+	RescueAfter time.Duration
+}
+
+func (c *ProcessorConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Processor"))
+	c.PollInterval = cmp.Or(c.PollInterval, DefaultPollInterval)
+	c.MinBackoff = cmp.Or(c.MinBackoff, DefaultMinBackoff)
+	c.MaxBackoff = cmp.Or(c.MaxBackoff, DefaultMaxBackoff)
+	c.JobTimeout = cmp.Or(c.JobTimeout, DefaultJobTimeout)
+	c.RescueAfter = cmp.Or(c.RescueAfter, max(DefaultRescueAfter, 2*c.JobTimeout))
+
+	debug.Assert(c.JobTimeout > 0, "expected JobTimeout to be positive")
+	debug.Assert(c.JobTimeout < c.RescueAfter, "expected JobTimeout to be less than RescueAfter")
+
+	if len(c.Queues) == 0 {
+		c.Queues = map[string]int{DefaultQueue: DefaultConcurrency}
+	}
+}
+
+// backoff returns a jittered delay before the next attempt after the given
+// number of attempts.
+func (c *ProcessorConfig) backoff(attempt int) time.Duration {
+	return dbsql.Backoff(attempt, c.MinBackoff, c.MaxBackoff)
+}
+
+// Processor fetches jobs from the queues and runs them with the workers
+// registered on the Client.
+//
+// A failed job is retried with exponential backoff until it exhausts its
+// attempts and is discarded. Stop stops fetching new jobs and waits for
+// the running ones to finish.
+type Processor struct {
+	client   *Client
+	pool     *pgxpool.Pool
+	config   *ProcessorConfig
+	stop     chan struct{}
+	kill     chan struct{}
+	done     chan struct{}
+	jobs     sync.WaitGroup
+	stopOnce sync.Once
+	killOnce sync.Once
+	launched atomic.Bool
+}
+
+// NewProcessor creates a new Processor running jobs enqueued with c.
+func (c *Client) NewProcessor(pool *pgxpool.Pool, config *ProcessorConfig) *Processor {
+	debug.Assert(pool != nil, "expected pool to be defined")
+
+	if config == nil {
+		//nolint:exhaustruct
+		config = &ProcessorConfig{}
+	}
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	return &Processor{
+		client: c,
+		pool:   pool,
+		config: config,
+		stop:   make(chan struct{}),
+		kill:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start processes jobs until ctx is cancelled or Stop is called.
+//
+// Cancelling ctx cancels the running jobs as well, while Stop lets them finish.
+func (p *Processor) Start(ctx context.Context) error {
+	if !p.launched.CompareAndSwap(false, true) {
+		return errors.New("jobqueue: processor already launched")
+	}
+	defer close(p.done)
+
+	jobsCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	go func() {
+		select {
+		case <-p.kill:
+			cancelJobs()
+		case <-jobsCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for queue, concurrency := range p.config.Queues {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			p.runQueue(ctx, jobsCtx, queue, concurrency)
+		}()
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		p.runRescuer(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		cancelJobs()
+	case <-p.stop:
+	}
+
+	wg.Wait()
+	p.jobs.Wait()
+
+	return nil
+}
+
+// Stop stops fetching jobs and waits for the running ones to finish.
+// If ctx is done first, the running jobs are cancelled and Stop returns
+// without waiting for them, jobs ignoring cancellation keep running in
+// the background until they return.
+func (p *Processor) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	if !p.launched.Load() {
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.killOnce.Do(func() { close(p.kill) })
+
+		return fmt.Errorf("jobqueue: failed to drain processor: %w", ctx.Err())
+	}
+}
+
+// runQueue fetches jobs from queue and runs up to concurrency of them at once.
+func (p *Processor) runQueue(ctx, jobsCtx context.Context, queue string, concurrency int) {
+	var (
+		running atomic.Int64
+		freed   = make(chan struct{}, 1)
+	)
+
+	for {
+		free := concurrency - int(running.Load())
+		fetched := 0
+
+		if free > 0 {
+			rows, err := p.fetch(ctx, queue, free)
+			if err != nil && ctx.Err() == nil {
+				p.config.Logger.ErrorContext(
+					ctx,
+					"Failed to fetch jobs",
+					slog.String("queue", queue),
+					slog.Any("error", err),
+				)
+			}
+
+			fetched = len(rows)
+
+			for _, r := range rows {
+				running.Add(1)
+				p.jobs.Add(1)
+
+				go func() {
+					defer func() {
+						running.Add(-1)
+						p.jobs.Done()
+
+						select {
+						case freed <- struct{}{}:
+						default:
+						}
+					}()
+
+					p.run(jobsCtx, r)
+				}()
+			}
+		}
+
+		// If the queue may have a backlog, fetch again as soon as
+		// there is a free slot.
+		var wake <-chan struct{}
+		if free <= 0 || fetched == free {
+			wake = freed
+		}
+
+		t := time.NewTimer(p.config.PollInterval)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-p.stop:
+			t.Stop()
+			return
+		case <-wake:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// runRescuer periodically makes jobs abandoned by crashed processors
+// available again.
+//
+// The abandoned attempt has been counted when the job was fetched,
+// so jobs that have exhausted their attempts are discarded instead.
+func (p *Processor) runRescuer(ctx context.Context) {
+	ticker := time.NewTicker(max(p.config.RescueAfter/4, p.config.PollInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		tag, err := p.pool.Exec(
+			ctx,
+			fmt.Sprintf(`UPDATE %s SET
+	state = CASE WHEN attempt >= max_attempts THEN 'discarded' ELSE 'available' END,
+	finished_at = CASE WHEN attempt >= max_attempts THEN now() END,
+	last_error = $2
+WHERE state = 'running' AND attempted_at < now() - $1::interval`, p.client.table),
+			p.config.RescueAfter,
+			errAbandoned.Error(),
+		)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.config.Logger.ErrorContext(ctx, "Failed to rescue jobs", slog.Any("error", err))
+			}
+
+			continue
+		}
+
+		if n := tag.RowsAffected(); n > 0 {
+			p.config.Logger.WarnContext(ctx, "Rescued abandoned jobs", slog.Int64("count", n))
+		}
+	}
+}
+
+// fetch claims up to limit available jobs from queue.
+func (p *Processor) fetch(ctx context.Context, queue string, limit int) ([]*row, error) {
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`UPDATE %[1]s SET state = 'running', attempt = attempt + 1, attempted_at = now()
+WHERE id IN (
+	SELECT id FROM %[1]s
+	WHERE state = 'available' AND queue = $1 AND run_at <= now()
+	ORDER BY priority DESC, run_at, id
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, queue, kind, args, priority, attempt, max_attempts, run_at, created_at`, p.client.table), queue, limit)
+	if err != nil {
+		return nil, fmt.Errorf("jobqueue: failed to fetch jobs: %w", err)
+	}
+
+	jobs, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[row])
+	if err != nil {
+		return nil, fmt.Errorf("jobqueue: failed to fetch jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// run runs a single job attempt and records its outcome.
+//
+// The outcome is only recorded if the job is still running the same attempt,
+// so an attempt outliving RescueAfter does not overwrite a newer one.
+func (p *Processor) run(ctx context.Context, r *row) {
+	start := time.Now()
+	err := p.work(ctx, r)
+
+	// The outcome is recorded even if the job has been cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if _, err := p.pool.Exec(
+			ctx,
+			fmt.Sprintf(
+				"UPDATE %s SET state = 'completed', finished_at = now() WHERE id = $1 AND %s",
+				p.client.table,
+				attemptRunning,
+			),
+			r.ID,
+			r.Attempt,
+		); err != nil {
+			p.config.Logger.ErrorContext(ctx, "Failed to complete job", slog.Int64("id", r.ID), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	attrs := []any{
+		slog.Int64("id", r.ID),
+		slog.String("kind", r.Kind),
+		slog.Int("attempt", r.Attempt),
+		slog.Duration("duration", time.Since(start)),
+		slog.Any("error", err),
+	}
+
+	var (
+		query string
+		args  []any
+	)
+
+	if r.Attempt >= r.MaxAttempts {
+		p.config.Logger.ErrorContext(ctx, "Job exhausted its attempts and is discarded", attrs...)
+
+		query = "UPDATE %s SET state = 'discarded', last_error = $3, finished_at = now() WHERE id = $1 AND %s"
+		args = []any{r.ID, r.Attempt, err.Error()}
+	} else {
+		p.config.Logger.WarnContext(ctx, "Job failed", attrs...)
+
+		query = "UPDATE %s SET state = 'available', last_error = $3, run_at = now() + $4::interval WHERE id = $1 AND %s"
+		args = []any{r.ID, r.Attempt, err.Error(), p.config.backoff(r.Attempt)}
+	}
+
+	if _, err := p.pool.Exec(ctx, fmt.Sprintf(query, p.client.table, attemptRunning), args...); err != nil {
+		p.config.Logger.ErrorContext(ctx, "Failed to record job failure", slog.Int64("id", r.ID), slog.Any("error", err))
+	}
+}
+
+// work runs the worker registered for r, turning panics into errors.
+func (p *Processor) work(ctx context.Context, r *row) (err error) {
+	w, ok := p.client.worker(r.Kind)
+	if !ok {
+		return fmt.Errorf("jobqueue: no worker registered for %q job", r.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.JobTimeout)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("jobqueue: worker for %q job panicked: %v", r.Kind, rec)
+		}
+	}()
+
+	return w(ctx, r)
+}
@@ -0,0 +1,307 @@
+package dbsql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"go.inout.gg/foundations/cursor"
+	"go.inout.gg/foundations/debug"
+)
+
+// SortColumn is a column a keyset-paginated query is ordered by.
+type SortColumn struct {
+	// Name is the name of the column in the result of the base query.
+	Name string
+
+	// Desc orders the column in descending order.
+	Desc bool
+}
+
+// KeysetQuery describes how a query is paginated with keyset (seek) pagination.
+type KeysetQuery[T any] struct {
+	// Codec encodes cursors.
+	Codec *cursor.Codec
+
+	// Key returns the values of Columns of a row, in the same order.
+	//
+	// The values are stored in cursors as JSON and bound back as text,
+	// so they must have a text representation Postgres parses as the type
+	// of the column, e.g. strings, numbers, booleans, time.Time or UUIDs.
+	// Binary values, such as []byte keys of bytea columns, are rejected.
+	Key func(T) []any
+
+	// Columns are the columns the query is ordered by. The combination of
+	// their values must be unique and not NULL, so the last column is
+	// typically a unique tiebreaker such as the primary key.
+	Columns []SortColumn
+}
+
+// KeysetPage describes a requested page.
+type KeysetPage struct {
+	// Cursor is the cursor of the page boundary, it is empty for
+	// the first page, or for the last page when paginating backward.
+	Cursor string
+
+	// Limit is the maximum number of rows in the page.
+	Limit int
+
+	// Backward requests the rows before Cursor instead of after it.
+	Backward bool
+}
+
+// KeysetResult is a page of rows.
+type KeysetResult[T any] struct {
+	// Items are the rows of the page in the order of KeysetQuery.Columns.
+	Items []T
+
+	// NextCursor is the cursor of the next page, empty if there is none.
+	NextCursor string
+
+	// PrevCursor is the cursor of the previous page, empty if there is none.
+	PrevCursor string
+
+	// HasMore reports whether there are more rows in the requested direction.
+	HasMore bool
+}
+
+// Build builds a query fetching page.Limit+1 rows of the base query from
+// the position described by the page cursor.
+//
+// The base query is wrapped into a subquery, filtered with a keyset predicate
+// and ordered by the sort columns, which must be present in its result.
+// args are the arguments of the base query, the page arguments are appended
+// after them, so args must not contain pgx query options.
+//
+// When paginating backward, the order is inverted, so the returned rows are
+// in the reversed order.
+func (k *KeysetQuery[T]) Build(base string, page KeysetPage, args ...any) (string, []any, error) {
+	debug.Assert(len(k.Columns) > 0, "expected keyset columns to be configured")
+	debug.Assert(page.Limit > 0, "expected page limit to be positive")
+
+	var (
+		sql strings.Builder
+		n   = len(args)
+	)
+
+	args = slices.Clone(args)
+
+	fmt.Fprintf(&sql, "SELECT * FROM (%s) AS keyset_page", base)
+
+	if page.Cursor != "" {
+		values, err := k.decode(page.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+
+		params := make([]string, len(values))
+		for i := range values {
+			params[i] = "$" + strconv.Itoa(n+i+1)
+		}
+
+		sql.WriteString(" WHERE ")
+		k.writePredicate(&sql, params, page.Backward)
+
+		args = append(args, values...)
+		n += len(values)
+	}
+
+	sql.WriteString(" ORDER BY ")
+
+	for i, c := range k.Columns {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+
+		sql.WriteString(pgx.Identifier{c.Name}.Sanitize())
+
+		if c.Desc != page.Backward {
+			sql.WriteString(" DESC")
+		} else {
+			sql.WriteString(" ASC")
+		}
+	}
+
+	fmt.Fprintf(&sql, " LIMIT $%d", n+1)
+
+	args = append(args, page.Limit+1)
+
+	return sql.String(), args, nil
+}
+
+// writePredicate writes the condition selecting rows after the cursor
+// values, or before them if backward is true.
+//
+// If all columns are ordered in the same direction, a row-value comparison
+// is used, which Postgres can serve with a single index range scan.
+// Otherwise it is expanded into (a > $1) OR (a = $1 AND b < $2) ...
+func (k *KeysetQuery[T]) writePredicate(sql *strings.Builder, params []string, backward bool) {
+	op := func(c SortColumn) string {
+		if c.Desc != backward {
+			return "<"
+		}
+
+		return ">"
+	}
+
+	sameOrder := true
+	for _, c := range k.Columns[1:] {
+		sameOrder = sameOrder && c.Desc == k.Columns[0].Desc
+	}
+
+	if sameOrder {
+		names := make([]string, len(k.Columns))
+		for i, c := range k.Columns {
+			names[i] = pgx.Identifier{c.Name}.Sanitize()
+		}
+
+		fmt.Fprintf(
+			sql,
+			"(%s) %s (%s)",
+			strings.Join(names, ", "),
+			op(k.Columns[0]),
+			strings.Join(params, ", "),
+		)
+
+		return
+	}
+
+	sql.WriteString("(")
+
+	for i, c := range k.Columns {
+		if i > 0 {
+			sql.WriteString(" OR ")
+		}
+
+		sql.WriteString("(")
+
+		for j := range i {
+			fmt.Fprintf(sql, "%s = %s AND ", pgx.Identifier{k.Columns[j].Name}.Sanitize(), params[j])
+		}
+
+		fmt.Fprintf(sql, "%s %s %s)", pgx.Identifier{c.Name}.Sanitize(), op(c), params[i])
+	}
+
+	sql.WriteString(")")
+}
+
+// encode encodes the cursor of row.
+func (k *KeysetQuery[T]) encode(row T) (string, error) {
+	values := k.Key(row)
+	debug.Assert(len(values) == len(k.Columns), "expected keyset key to return a value per column")
+
+	for i, v := range values {
+		if _, ok := v.([]byte); ok {
+			return "", fmt.Errorf("dbsql: failed to encode cursor: unsupported []byte value of column %q", k.Columns[i].Name)
+		}
+	}
+
+	s, err := k.Codec.Encode(values)
+	if err != nil {
+		return "", fmt.Errorf("dbsql: failed to encode cursor: %w", err)
+	}
+
+	return s, nil
+}
+
+// decode decodes the cursor values as query arguments.
+//
+// The values are passed as strings in the text format, so Postgres parses
+// them as the types of the sort columns, and no precision is lost in
+// the JSON round trip of numbers and timestamps.
+func (k *KeysetQuery[T]) decode(s string) ([]any, error) {
+	var raw []json.RawMessage
+	if err := k.Codec.Decode(s, &raw); err != nil {
+		return nil, fmt.Errorf("dbsql: failed to decode cursor: %w", err)
+	}
+
+	if len(raw) != len(k.Columns) {
+		return nil, fmt.Errorf("dbsql: failed to decode cursor: %w", cursor.ErrInvalidCursor)
+	}
+
+	values := make([]any, len(raw))
+
+	for i, r := range raw {
+		var v any
+		if err := json.Unmarshal(r, &v); err != nil || v == nil {
+			return nil, fmt.Errorf("dbsql: failed to decode cursor: %w", cursor.ErrInvalidCursor)
+		}
+
+		if str, ok := v.(string); ok {
+			values[i] = str
+		} else {
+			values[i] = string(r)
+		}
+	}
+
+	return values, nil
+}
+
+// QueryKeyset runs a keyset-paginated query built with KeysetQuery.Build and
+// scans the rows of the page into T with QueryAll.
+//
+// The next cursor is built from the last row of the page and the previous
+// cursor from the first one. An invalid cursor is reported with an error
+// wrapping cursor.ErrInvalidCursor.
+func QueryKeyset[T any](
+	ctx context.Context,
+	db DBTX,
+	keyset *KeysetQuery[T],
+	base string,
+	page KeysetPage,
+	args ...any,
+) (*KeysetResult[T], error) {
+	debug.Assert(keyset.Codec != nil, "expected keyset codec to be configured")
+	debug.Assert(keyset.Key != nil, "expected keyset key to be configured")
+
+	sql, args, err := keyset.Build(base, page, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := QueryAll[T](ctx, db, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(rows) > page.Limit
+	if hasMore {
+		rows = rows[:page.Limit]
+	}
+
+	if page.Backward {
+		slices.Reverse(rows)
+	}
+
+	result := &KeysetResult[T]{
+		Items:      rows,
+		NextCursor: "",
+		PrevCursor: "",
+		HasMore:    hasMore,
+	}
+
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	hasNext, hasPrev := cursor.Adjacent(hasMore, page.Cursor != "", page.Backward)
+
+	if hasNext {
+		if result.NextCursor, err = keyset.encode(rows[len(rows)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasPrev {
+		if result.PrevCursor, err = keyset.encode(rows[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
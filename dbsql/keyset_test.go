@@ -0,0 +1,163 @@
+package dbsql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/cursor"
+)
+
+type post struct {
+	CreatedAt string
+	ID        int64
+}
+
+func TestKeysetQuery(t *testing.T) {
+	codec := cursor.NewCodec([]byte(strings.Repeat("s", cursor.MinSecretLength)))
+	key := func(p post) []any { return []any{p.CreatedAt, p.ID} }
+
+	sameOrder := &KeysetQuery[post]{
+		Codec:   codec,
+		Key:     key,
+		Columns: []SortColumn{{Name: "created_at", Desc: true}, {Name: "id", Desc: true}},
+	}
+	mixedOrder := &KeysetQuery[post]{
+		Codec:   codec,
+		Key:     key,
+		Columns: []SortColumn{{Name: "created_at", Desc: true}, {Name: "id"}},
+	}
+
+	c, err := codec.Encode([]any{"2024-01-01T00:00:00Z", int64(9007199254740993)})
+	require.NoError(t, err)
+
+	t.Run("it builds the first page", func(t *testing.T) {
+		sql, args, err := sameOrder.Build("SELECT * FROM posts WHERE author_id = $1", KeysetPage{Limit: 10}, 1)
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			`SELECT * FROM (SELECT * FROM posts WHERE author_id = $1) AS keyset_page `+
+				`ORDER BY "created_at" DESC, "id" DESC LIMIT $2`,
+			sql,
+		)
+		assert.Equal(t, []any{1, 11}, args)
+	})
+
+	t.Run("it uses row-value comparison for the same order", func(t *testing.T) {
+		sql, args, err := sameOrder.Build("SELECT * FROM posts", KeysetPage{Limit: 10, Cursor: c})
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			`SELECT * FROM (SELECT * FROM posts) AS keyset_page WHERE ("created_at", "id") < ($1, $2) `+
+				`ORDER BY "created_at" DESC, "id" DESC LIMIT $3`,
+			sql,
+		)
+		assert.Equal(t, []any{"2024-01-01T00:00:00Z", "9007199254740993", 11}, args)
+	})
+
+	t.Run("it expands the predicate for mixed order", func(t *testing.T) {
+		sql, _, err := mixedOrder.Build("SELECT * FROM posts", KeysetPage{Limit: 10, Cursor: c})
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			`SELECT * FROM (SELECT * FROM posts) AS keyset_page `+
+				`WHERE (("created_at" < $1) OR ("created_at" = $1 AND "id" > $2)) `+
+				`ORDER BY "created_at" DESC, "id" ASC LIMIT $3`,
+			sql,
+		)
+	})
+
+	t.Run("it inverts the order when paginating backward", func(t *testing.T) {
+		sql, _, err := mixedOrder.Build("SELECT * FROM posts", KeysetPage{Limit: 10, Cursor: c, Backward: true})
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			`SELECT * FROM (SELECT * FROM posts) AS keyset_page `+
+				`WHERE (("created_at" > $1) OR ("created_at" = $1 AND "id" < $2)) `+
+				`ORDER BY "created_at" ASC, "id" DESC LIMIT $3`,
+			sql,
+		)
+	})
+
+	t.Run("it rejects invalid cursors", func(t *testing.T) {
+		_, _, err := sameOrder.Build("SELECT * FROM posts", KeysetPage{Limit: 10, Cursor: "invalid"})
+		require.ErrorIs(t, err, cursor.ErrInvalidCursor)
+
+		short, err := codec.Encode([]any{1})
+		require.NoError(t, err)
+
+		_, _, err = sameOrder.Build("SELECT * FROM posts", KeysetPage{Limit: 10, Cursor: short})
+		require.ErrorIs(t, err, cursor.ErrInvalidCursor)
+	})
+}
+
+func TestQueryKeyset(t *testing.T) {
+	ctx := context.Background()
+	codec := cursor.NewCodec([]byte(strings.Repeat("s", cursor.MinSecretLength)))
+	keyset := &KeysetQuery[post]{
+		Codec:   codec,
+		Key:     func(p post) []any { return []any{p.CreatedAt, p.ID} },
+		Columns: []SortColumn{{Name: "created_at"}, {Name: "id"}},
+	}
+
+	rows := func(ids ...int64) *fakeRows {
+		values := make([][]any, len(ids))
+		for i, id := range ids {
+			values[i] = []any{"today", id}
+		}
+
+		return &fakeRows{columns: []string{"created_at", "id"}, values: values}
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		db := &rowsDB{rows: rows(1, 2, 3)}
+
+		result, err := QueryKeyset(ctx, db, keyset, "SELECT * FROM posts", KeysetPage{Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []post{{"today", 1}, {"today", 2}}, result.Items)
+		assert.True(t, result.HasMore)
+		assert.Empty(t, result.PrevCursor)
+
+		values, err := keyset.decode(result.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, []any{"today", "2"}, values)
+	})
+
+	t.Run("backward page", func(t *testing.T) {
+		c, err := codec.Encode([]any{"today", 5})
+		require.NoError(t, err)
+
+		db := &rowsDB{rows: rows(4, 3)}
+
+		result, err := QueryKeyset(ctx, db, keyset, "SELECT * FROM posts", KeysetPage{Limit: 2, Cursor: c, Backward: true})
+		require.NoError(t, err)
+		assert.Equal(t, []post{{"today", 3}, {"today", 4}}, result.Items)
+		assert.False(t, result.HasMore)
+		assert.Empty(t, result.PrevCursor)
+
+		values, err := keyset.decode(result.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, []any{"today", "4"}, values)
+	})
+
+	t.Run("empty page", func(t *testing.T) {
+		result, err := QueryKeyset(ctx, &rowsDB{rows: rows()}, keyset, "SELECT * FROM posts", KeysetPage{Limit: 2})
+		require.NoError(t, err)
+		assert.Empty(t, result.Items)
+		assert.Empty(t, result.NextCursor)
+	})
+
+	t.Run("binary keys", func(t *testing.T) {
+		keyset := &KeysetQuery[post]{
+			Codec:   codec,
+			Key:     func(p post) []any { return []any{[]byte(p.CreatedAt), p.ID} },
+			Columns: []SortColumn{{Name: "created_at"}, {Name: "id"}},
+		}
+
+		_, err := QueryKeyset(ctx, &rowsDB{rows: rows(1, 2, 3)}, keyset, "SELECT * FROM posts", KeysetPage{Limit: 2})
+		require.ErrorContains(t, err, `unsupported []byte value of column "created_at"`)
+	})
+}
@@ -0,0 +1,230 @@
+package dbsql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/startstop"
+)
+
+var _ startstop.Starter = (*Elector)(nil)
+
+const (
+	DefaultElectorRetryInterval = 5 * time.Second
+	DefaultElectorCheckInterval = 5 * time.Second
+)
+
+// ElectorConfig configures an Elector.
+type ElectorConfig struct {
+	// Logger is used to log leadership changes.
+	Logger *slog.Logger
+
+	// OnChange is called whenever leadership is gained or lost.
+	// It is called synchronously from the election loop.
+	OnChange func(ctx context.Context, leader bool)
+
+	// Key is the key of the advisory lock the replicas compete for.
+	// Use StringLockKey to derive it from a name.
+	Key int64
+
+	// RetryInterval is the interval between attempts to win leadership.
+	RetryInterval time.Duration
+
+	// CheckInterval is the interval between checks that the leader's
+	// connection is still alive.
+	CheckInterval time.Duration
+}
+
+func (c *ElectorConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Elector"))
+	c.RetryInterval = cmp.Or(c.RetryInterval, DefaultElectorRetryInterval)
+	c.CheckInterval = cmp.Or(c.CheckInterval, DefaultElectorCheckInterval)
+}
+
+// Elector elects a single leader among replicas sharing a database.
+//
+// The leader is the replica holding a session-level advisory lock on
+// a dedicated connection. If the connection drops, leadership is given up and
+// the Elector tries to win it back.
+type Elector struct {
+	pool     *pgxpool.Pool
+	config   *ElectorConfig
+	changes  chan bool
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	leader   atomic.Bool
+	launched atomic.Bool
+}
+
+// NewElector creates a new Elector competing for config.Key.
+func NewElector(pool *pgxpool.Pool, config *ElectorConfig) *Elector {
+	debug.Assert(pool != nil, "expected pool to be defined")
+
+	if config == nil {
+		//nolint:exhaustruct
+		config = &ElectorConfig{}
+	}
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	return &Elector{
+		pool:    pool,
+		config:  config,
+		changes: make(chan bool, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// IsLeader reports whether the replica is currently the leader.
+func (e *Elector) IsLeader() bool { return e.leader.Load() }
+
+// Changes returns a channel receiving the latest leadership state whenever
+// it changes. Only the latest state is kept if the receiver falls behind.
+func (e *Elector) Changes() <-chan bool { return e.changes }
+
+// Start campaigns for leadership until ctx is cancelled or Stop is called.
+func (e *Elector) Start(ctx context.Context) error {
+	if !e.launched.CompareAndSwap(false, true) {
+		return errors.New("dbsql: elector already launched")
+	}
+	defer close(e.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-e.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		err := e.campaign(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			e.config.Logger.ErrorContext(ctx, "Leader election failed", slog.Any("error", err))
+		}
+
+		if !sleep(ctx, e.config.RetryInterval) {
+			return nil
+		}
+	}
+}
+
+// Stop gives up leadership and stops the election loop.
+func (e *Elector) Stop(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+
+	if !e.launched.Load() {
+		return nil
+	}
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("dbsql: failed to stop elector: %w", ctx.Err())
+	}
+}
+
+// campaign waits for leadership on a dedicated connection and holds it
+// until the connection is lost or ctx is cancelled.
+func (e *Elector) campaign(ctx context.Context) error {
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("dbsql: failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	for {
+		ok, err := TryAcquireLock(ctx, conn, e.config.Key)
+		if err != nil {
+			_ = conn.Conn().Close(context.WithoutCancel(ctx))
+			return err
+		}
+
+		if ok {
+			break
+		}
+
+		if !sleep(ctx, e.config.RetryInterval) {
+			return nil
+		}
+	}
+
+	e.setLeader(ctx, true)
+
+	ticker := time.NewTicker(e.config.CheckInterval)
+	defer ticker.Stop()
+
+	// Leadership is given up before the lock is released, so that the old
+	// leader never acts as one while another replica holds the lock.
+	for {
+		select {
+		case <-ctx.Done():
+			e.setLeader(ctx, false)
+
+			if err := ReleaseLock(context.WithoutCancel(ctx), conn, e.config.Key); err != nil {
+				_ = conn.Conn().Close(context.WithoutCancel(ctx))
+				return err
+			}
+
+			return nil
+		case <-ticker.C:
+			if err := conn.Ping(ctx); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				e.setLeader(ctx, false)
+
+				// The lock is lost with the session, make sure the connection
+				// does not return to the pool.
+				_ = conn.Conn().Close(context.WithoutCancel(ctx))
+
+				return fmt.Errorf("dbsql: leader connection lost: %w", err)
+			}
+		}
+	}
+}
+
+func (e *Elector) setLeader(ctx context.Context, leader bool) {
+	if e.leader.Swap(leader) == leader {
+		return
+	}
+
+	if leader {
+		e.config.Logger.InfoContext(ctx, "Gained leadership", slog.Int64("key", e.config.Key))
+	} else {
+		e.config.Logger.InfoContext(ctx, "Lost leadership", slog.Int64("key", e.config.Key))
+	}
+
+	if e.config.OnChange != nil {
+		e.config.OnChange(ctx, leader)
+	}
+
+	// Keep only the latest state.
+	select {
+	case <-e.changes:
+	default:
+	}
+
+	e.changes <- leader
+}
@@ -0,0 +1,61 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElector(t *testing.T) {
+	// The pool connects lazily, so it can be created for an unreachable database.
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/test?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	t.Run("it reports leadership changes", func(t *testing.T) {
+		var changes []bool
+
+		e := NewElector(pool, &ElectorConfig{
+			OnChange: func(_ context.Context, leader bool) { changes = append(changes, leader) },
+		})
+
+		e.setLeader(context.Background(), true)
+		e.setLeader(context.Background(), true)
+		assert.True(t, e.IsLeader())
+		assert.True(t, <-e.Changes())
+
+		e.setLeader(context.Background(), false)
+		assert.False(t, e.IsLeader())
+		assert.False(t, <-e.Changes())
+
+		assert.Equal(t, []bool{true, false}, changes)
+	})
+
+	t.Run("it keeps only the latest state", func(t *testing.T) {
+		e := NewElector(pool, &ElectorConfig{})
+
+		e.setLeader(context.Background(), true)
+		e.setLeader(context.Background(), false)
+		assert.False(t, <-e.Changes())
+	})
+
+	t.Run("it stops while failing to connect", func(t *testing.T) {
+		e := NewElector(pool, &ElectorConfig{RetryInterval: time.Millisecond})
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- e.Start(context.Background()) }()
+
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		require.NoError(t, e.Stop(ctx))
+		require.NoError(t, <-errCh)
+		assert.False(t, e.IsLeader())
+	})
+}
@@ -0,0 +1,298 @@
+package dbsql
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/startstop"
+)
+
+var _ startstop.Starter = (*Listener)(nil)
+
+const (
+	DefaultListenerMinBackoff = 100 * time.Millisecond
+	DefaultListenerMaxBackoff = 30 * time.Second
+)
+
+// Notify sends a notification with payload to channel.
+//
+// When db is a transaction, the notification is delivered on commit.
+func Notify(ctx context.Context, db DBTX, channel string, payload string) error {
+	if _, err := db.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		return fmt.Errorf("dbsql: failed to notify %q: %w", channel, err)
+	}
+
+	return nil
+}
+
+// NotifyJSON sends a notification with JSON encoded v to channel.
+func NotifyJSON(ctx context.Context, db DBTX, channel string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("dbsql: failed to encode notification payload: %w", err)
+	}
+
+	return Notify(ctx, db, channel, string(payload))
+}
+
+// Subscriber receives notifications from a Listener.
+//
+// Methods are called synchronously from the listener loop and must not block.
+type Subscriber interface {
+	// Notify is called for each received notification.
+	Notify(context.Context, *pgconn.Notification)
+
+	// Gap is called after the listener has reconnected, as notifications sent
+	// while it was disconnected are lost. Subscribers should resync their state.
+	Gap(context.Context)
+}
+
+// ListenerConfig configures a Listener.
+type ListenerConfig struct {
+	// Logger is used to log connection failures.
+	Logger *slog.Logger
+
+	// Channels is the set of channels to LISTEN on.
+	Channels []string
+
+	// MinBackoff is the base delay between reconnection attempts.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between reconnection attempts.
+	MaxBackoff time.Duration
+}
+
+func (c *ListenerConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Listener"))
+	c.MinBackoff = cmp.Or(c.MinBackoff, DefaultListenerMinBackoff)
+	c.MaxBackoff = cmp.Or(c.MaxBackoff, DefaultListenerMaxBackoff)
+}
+
+// Listener LISTENs on a set of channels using a dedicated connection and fans
+// notifications out to subscribers.
+type Listener struct {
+	pool        *pgxpool.Pool
+	config      *ListenerConfig
+	subscribers map[string][]*subscription
+	stop        chan struct{}
+	done        chan struct{}
+	mu          sync.RWMutex
+	stopOnce    sync.Once
+	launched    atomic.Bool
+}
+
+type subscription struct{ Subscriber }
+
+// NewListener creates a new Listener for config.Channels.
+func NewListener(pool *pgxpool.Pool, config *ListenerConfig) *Listener {
+	debug.Assert(pool != nil, "expected pool to be defined")
+	debug.Assert(config != nil && len(config.Channels) > 0, "expected channels to be defined")
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	return &Listener{
+		pool:        pool,
+		config:      config,
+		subscribers: make(map[string][]*subscription, len(config.Channels)),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe registers s to receive notifications from channel and returns
+// a function removing the subscription.
+func (l *Listener) Subscribe(channel string, s Subscriber) func() {
+	debug.Assert(slices.Contains(l.config.Channels, channel), "expected channel %q to be listened", channel)
+
+	sub := &subscription{s}
+
+	l.mu.Lock()
+	l.subscribers[channel] = append(l.subscribers[channel], sub)
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.subscribers[channel] = slices.DeleteFunc(
+			l.subscribers[channel],
+			func(other *subscription) bool { return other == sub },
+		)
+	}
+}
+
+// Subscribe registers fn to receive JSON payloads from channel decoded into T
+// and returns a function removing the subscription.
+//
+// Payloads that cannot be decoded are logged and skipped. onGap, if not nil,
+// is called when notifications may have been lost.
+func Subscribe[T any](
+	l *Listener,
+	channel string,
+	fn func(context.Context, T),
+	onGap func(context.Context),
+) func() {
+	return l.Subscribe(channel, &jsonSubscriber[T]{fn: fn, onGap: onGap, log: l.config.Logger})
+}
+
+type jsonSubscriber[T any] struct {
+	log   *slog.Logger
+	fn    func(context.Context, T)
+	onGap func(context.Context)
+}
+
+func (s *jsonSubscriber[T]) Notify(ctx context.Context, n *pgconn.Notification) {
+	var v T
+	if err := json.Unmarshal([]byte(n.Payload), &v); err != nil {
+		s.log.ErrorContext(
+			ctx,
+			"Failed to decode notification payload",
+			slog.String("channel", n.Channel),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	s.fn(ctx, v)
+}
+
+func (s *jsonSubscriber[T]) Gap(ctx context.Context) {
+	if s.onGap != nil {
+		s.onGap(ctx)
+	}
+}
+
+// Start listens for notifications until ctx is cancelled or Stop is called,
+// reconnecting with backoff when the connection is lost.
+func (l *Listener) Start(ctx context.Context) error {
+	if !l.launched.CompareAndSwap(false, true) {
+		return errors.New("dbsql: listener already launched")
+	}
+	defer close(l.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-l.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reconnect := false
+
+	for attempt := 1; ; attempt++ {
+		connected, err := l.listen(ctx, reconnect)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if connected {
+			reconnect = true
+			attempt = 1
+		}
+
+		d := Backoff(attempt, l.config.MinBackoff, l.config.MaxBackoff)
+		l.config.Logger.ErrorContext(
+			ctx,
+			"Listener connection failed",
+			slog.Any("error", err),
+			slog.Duration("retry_in", d),
+		)
+
+		if !sleep(ctx, d) {
+			return nil
+		}
+	}
+}
+
+// Stop stops listening for notifications.
+func (l *Listener) Stop(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	if !l.launched.Load() {
+		return nil
+	}
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("dbsql: failed to stop listener: %w", ctx.Err())
+	}
+}
+
+// listen LISTENs on a dedicated connection and dispatches notifications
+// until the connection fails, reporting whether it has managed to LISTEN.
+// If reconnect is true, subscribers are told about a gap once LISTENing.
+func (l *Listener) listen(ctx context.Context, reconnect bool) (bool, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbsql: failed to acquire connection: %w", err)
+	}
+
+	defer func() {
+		// The connection is still LISTENing, so it must not return to the pool.
+		_ = conn.Conn().Close(context.WithoutCancel(ctx))
+		conn.Release()
+	}()
+
+	for _, channel := range l.config.Channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return false, fmt.Errorf("dbsql: failed to listen on %q: %w", channel, err)
+		}
+	}
+
+	if reconnect {
+		l.gap(ctx)
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return true, fmt.Errorf("dbsql: failed to wait for notification: %w", err)
+		}
+
+		l.dispatch(ctx, n)
+	}
+}
+
+func (l *Listener) dispatch(ctx context.Context, n *pgconn.Notification) {
+	l.mu.RLock()
+	subscribers := slices.Clone(l.subscribers[n.Channel])
+	l.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.Notify(ctx, n)
+	}
+}
+
+func (l *Listener) gap(ctx context.Context) {
+	l.mu.RLock()
+	var subscribers []*subscription
+	for _, subs := range l.subscribers {
+		subscribers = append(subscribers, subs...)
+	}
+	l.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.Gap(ctx)
+	}
+}
@@ -0,0 +1,80 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	db := &lockDB{}
+
+	require.NoError(t, Notify(context.Background(), db, "events", "payload"))
+	require.NoError(t, NotifyJSON(context.Background(), db, "events", map[string]int{"id": 1}))
+	assert.Equal(t, []string{"SELECT pg_notify($1, $2)", "SELECT pg_notify($1, $2)"}, db.queries)
+}
+
+func TestListener(t *testing.T) {
+	ctx := context.Background()
+
+	// The pool connects lazily, so it can be created for an unreachable database.
+	pool, err := pgxpool.New(ctx, "postgres://localhost:1/test?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	type event struct {
+		ID int `json:"id"`
+	}
+
+	t.Run("it decodes payloads for subscribers", func(t *testing.T) {
+		l := NewListener(pool, &ListenerConfig{Channels: []string{"events", "other"}})
+
+		var (
+			events []event
+			gaps   int
+		)
+
+		unsubscribe := Subscribe(l, "events", func(_ context.Context, e event) {
+			events = append(events, e)
+		}, func(context.Context) { gaps++ })
+
+		l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `{"id":1}`})
+		l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `malformed`})
+		l.dispatch(ctx, &pgconn.Notification{Channel: "other", Payload: `{"id":2}`})
+		l.gap(ctx)
+
+		assert.Equal(t, []event{{ID: 1}}, events)
+		assert.Equal(t, 1, gaps)
+
+		unsubscribe()
+		l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `{"id":3}`})
+		l.gap(ctx)
+
+		assert.Equal(t, []event{{ID: 1}}, events)
+		assert.Equal(t, 1, gaps)
+	})
+
+	t.Run("it stops while failing to connect", func(t *testing.T) {
+		l := NewListener(pool, &ListenerConfig{
+			Channels:   []string{"events"},
+			MinBackoff: time.Millisecond,
+			MaxBackoff: time.Millisecond,
+		})
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- l.Start(ctx) }()
+
+		time.Sleep(10 * time.Millisecond)
+
+		stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		require.NoError(t, l.Stop(stopCtx))
+		require.NoError(t, <-errCh)
+	})
+}
@@ -0,0 +1,188 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLockNotHeld is returned when releasing an advisory lock that is not
+// held by the session.
+var ErrLockNotHeld = errors.New("dbsql: advisory lock is not held")
+
+// StringLockKey hashes s into an advisory lock key.
+func StringLockKey(s string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+
+	return int64(h.Sum64()) //nolint:gosec // overflow is intended
+}
+
+// AcquireLock acquires a session-level advisory lock, waiting until it is
+// available.
+//
+// Session-level locks are held until released with ReleaseLock or until the
+// session ends, so db must be a dedicated connection, not a pool.
+func AcquireLock(ctx context.Context, db DBTX, key int64) error {
+	if _, err := db.Exec(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		return fmt.Errorf("dbsql: failed to acquire advisory lock %d: %w", key, err)
+	}
+
+	return nil
+}
+
+// TryAcquireLock acquires a session-level advisory lock if it is available
+// and reports whether it was acquired.
+func TryAcquireLock(ctx context.Context, db DBTX, key int64) (bool, error) {
+	var ok bool
+	if err := db.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		return false, fmt.Errorf("dbsql: failed to acquire advisory lock %d: %w", key, err)
+	}
+
+	return ok, nil
+}
+
+// ReleaseLock releases a session-level advisory lock.
+//
+// If the lock is not held by the session, ErrLockNotHeld is returned.
+func ReleaseLock(ctx context.Context, db DBTX, key int64) error {
+	var ok bool
+	if err := db.QueryRow(ctx, "SELECT pg_advisory_unlock($1)", key).Scan(&ok); err != nil {
+		return fmt.Errorf("dbsql: failed to release advisory lock %d: %w", key, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrLockNotHeld, key)
+	}
+
+	return nil
+}
+
+// AcquireTxLock acquires a transaction-level advisory lock, waiting until it
+// is available. The lock is released when the transaction ends.
+func AcquireTxLock(ctx context.Context, tx DBTX, key int64) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", key); err != nil {
+		return fmt.Errorf("dbsql: failed to acquire advisory lock %d: %w", key, err)
+	}
+
+	return nil
+}
+
+// TryAcquireTxLock acquires a transaction-level advisory lock if it is
+// available and reports whether it was acquired.
+func TryAcquireTxLock(ctx context.Context, tx DBTX, key int64) (bool, error) {
+	var ok bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", key).Scan(&ok); err != nil {
+		return false, fmt.Errorf("dbsql: failed to acquire advisory lock %d: %w", key, err)
+	}
+
+	return ok, nil
+}
+
+// WithTxLock runs fn within a transaction started on db with WithTx while
+// holding a transaction-level advisory lock, waiting until the lock is
+// available. The lock is released when the transaction ends.
+func WithTxLock(ctx context.Context, db DBTX, key int64, fn TxFunc, opts ...func(*TxConfig)) error {
+	//nolint:exhaustruct
+	return WithTx(ctx, db, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		if err := AcquireTxLock(ctx, tx, key); err != nil {
+			return err
+		}
+
+		return fn(ctx, tx)
+	}, opts...)
+}
+
+// WithTryTxLock runs fn within a transaction started on db with WithTx if
+// a transaction-level advisory lock is available, and reports whether fn
+// was run. The lock is released when the transaction ends.
+func WithTryTxLock(ctx context.Context, db DBTX, key int64, fn TxFunc, opts ...func(*TxConfig)) (bool, error) {
+	//nolint:exhaustruct
+	err := WithTx(ctx, db, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		ok, err := TryAcquireTxLock(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errLockBusy
+		}
+
+		return fn(ctx, tx)
+	}, opts...)
+	if errors.Is(err, errLockBusy) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// WithLock runs fn on a connection acquired from pool while holding
+// a session-level advisory lock, waiting until the lock is available.
+func WithLock(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	key int64,
+	fn func(context.Context, *pgxpool.Conn) error,
+) error {
+	_, err := withLock(ctx, pool, key, AcquireLock, fn)
+	return err
+}
+
+// WithTryLock runs fn on a connection acquired from pool if a session-level
+// advisory lock is available, and reports whether fn was run.
+func WithTryLock(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	key int64,
+	fn func(context.Context, *pgxpool.Conn) error,
+) (bool, error) {
+	return withLock(ctx, pool, key, func(ctx context.Context, db DBTX, key int64) error {
+		ok, err := TryAcquireLock(ctx, db, key)
+		if err == nil && !ok {
+			return errLockBusy
+		}
+
+		return err
+	}, fn)
+}
+
+// errLockBusy signals that a try-lock did not acquire the lock.
+var errLockBusy = errors.New("dbsql: advisory lock is busy")
+
+func withLock(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	key int64,
+	acquire func(context.Context, DBTX, int64) error,
+	fn func(context.Context, *pgxpool.Conn) error,
+) (locked bool, err error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dbsql: failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if err := acquire(ctx, conn, key); err != nil {
+		if errors.Is(err, errLockBusy) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	defer func() {
+		if releaseErr := ReleaseLock(context.WithoutCancel(ctx), conn, key); releaseErr != nil {
+			// The session may still hold the lock, make sure it does not
+			// return to the pool.
+			_ = conn.Conn().Close(context.WithoutCancel(ctx))
+			err = errors.Join(err, releaseErr)
+		}
+	}()
+
+	return true, fn(ctx, conn)
+}
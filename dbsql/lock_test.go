@@ -0,0 +1,158 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// boolRow is a pgx.Row returning a single boolean.
+type boolRow bool
+
+func (r boolRow) Scan(dest ...any) error {
+	*dest[0].(*bool) = bool(r) //nolint:forcetypeassert // the destination is known
+	return nil
+}
+
+// lockDB records queries and answers lock functions with result.
+type lockDB struct {
+	DBTX
+
+	queries []string
+	result  bool
+}
+
+func (db *lockDB) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	db.queries = append(db.queries, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *lockDB) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	db.queries = append(db.queries, sql)
+	return boolRow(db.result)
+}
+
+func (db *lockDB) Begin(context.Context) (pgx.Tx, error) {
+	db.queries = append(db.queries, "BEGIN")
+	return &lockTx{Tx: nil, db: db}, nil
+}
+
+// lockTx is a transaction answering lock functions with db.
+type lockTx struct {
+	pgx.Tx
+
+	db *lockDB
+}
+
+func (tx *lockTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *lockTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *lockTx) Commit(context.Context) error {
+	tx.db.queries = append(tx.db.queries, "COMMIT")
+	return nil
+}
+
+func (tx *lockTx) Rollback(context.Context) error {
+	tx.db.queries = append(tx.db.queries, "ROLLBACK")
+	return nil
+}
+
+func TestStringLockKey(t *testing.T) {
+	assert.Equal(t, StringLockKey("jobs"), StringLockKey("jobs"))
+	assert.NotEqual(t, StringLockKey("jobs"), StringLockKey("outbox"))
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("session lock", func(t *testing.T) {
+		db := &lockDB{result: true}
+
+		require.NoError(t, AcquireLock(ctx, db, 1))
+
+		ok, err := TryAcquireLock(ctx, db, 1)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		require.NoError(t, ReleaseLock(ctx, db, 1))
+
+		assert.Equal(t, []string{
+			"SELECT pg_advisory_lock($1)",
+			"SELECT pg_try_advisory_lock($1)",
+			"SELECT pg_advisory_unlock($1)",
+		}, db.queries)
+	})
+
+	t.Run("transaction lock", func(t *testing.T) {
+		db := &lockDB{result: false}
+
+		require.NoError(t, AcquireTxLock(ctx, db, 1))
+
+		ok, err := TryAcquireTxLock(ctx, db, 1)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.Equal(t, []string{
+			"SELECT pg_advisory_xact_lock($1)",
+			"SELECT pg_try_advisory_xact_lock($1)",
+		}, db.queries)
+	})
+
+	t.Run("scoped transaction lock", func(t *testing.T) {
+		db := &lockDB{result: true}
+
+		err := WithTxLock(ctx, db, 1, func(ctx context.Context, tx pgx.Tx) error {
+			require.NoError(t, RequireTx(ctx))
+
+			_, err := tx.Exec(ctx, "UPDATE t SET x = 1")
+
+			return err
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"BEGIN",
+			"SELECT pg_advisory_xact_lock($1)",
+			"UPDATE t SET x = 1",
+			"COMMIT",
+		}, db.queries)
+	})
+
+	t.Run("scoped transaction try lock", func(t *testing.T) {
+		db := &lockDB{result: true}
+
+		ran, err := WithTryTxLock(ctx, db, 1, func(context.Context, pgx.Tx) error { return nil })
+		require.NoError(t, err)
+		assert.True(t, ran)
+
+		assert.Equal(t, []string{"BEGIN", "SELECT pg_try_advisory_xact_lock($1)", "COMMIT"}, db.queries)
+	})
+
+	t.Run("scoped transaction try lock that is busy", func(t *testing.T) {
+		db := &lockDB{result: false}
+
+		ran, err := WithTryTxLock(ctx, db, 1, func(context.Context, pgx.Tx) error {
+			t.Fatal("fn must not run without the lock")
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, ran)
+
+		assert.Equal(t, []string{"BEGIN", "SELECT pg_try_advisory_xact_lock($1)", "ROLLBACK"}, db.queries)
+	})
+
+	t.Run("release of a lock that is not held", func(t *testing.T) {
+		db := &lockDB{result: false}
+
+		require.ErrorIs(t, ReleaseLock(ctx, db, 1), ErrLockNotHeld)
+	})
+}
@@ -0,0 +1,263 @@
+package dbsql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/startstop"
+)
+
+var _ startstop.Starter = (*ManagedPool)(nil)
+
+const (
+	DefaultManagedPoolMaxAttempts    = 10
+	DefaultManagedPoolMinBackoff     = 100 * time.Millisecond
+	DefaultManagedPoolMaxBackoff     = 10 * time.Second
+	DefaultManagedPoolHealthInterval = 10 * time.Second
+)
+
+// ManagedPoolConfig configures a ManagedPool.
+type ManagedPoolConfig struct {
+	// Logger is used to log connection attempts and health changes.
+	Logger *slog.Logger
+
+	// MaxAttempts is the maximum number of attempts to connect to
+	// the database on Start.
+	MaxAttempts int
+
+	// MinBackoff is the base delay between connection attempts.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between connection attempts.
+	MaxBackoff time.Duration
+
+	// HealthInterval is the interval between health pings.
+	HealthInterval time.Duration
+}
+
+func (c *ManagedPoolConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "ManagedPool"))
+	c.MaxAttempts = cmp.Or(c.MaxAttempts, DefaultManagedPoolMaxAttempts)
+	c.MinBackoff = cmp.Or(c.MinBackoff, DefaultManagedPoolMinBackoff)
+	c.MaxBackoff = cmp.Or(c.MaxBackoff, DefaultManagedPoolMaxBackoff)
+	c.HealthInterval = cmp.Or(c.HealthInterval, DefaultManagedPoolHealthInterval)
+}
+
+// ManagedPool is a connection pool whose lifecycle is managed with
+// startstop.Starter.
+//
+// Unlike NewPool, it does not fail if the database is not up yet: Start waits
+// for the database with bounded exponential backoff, then keeps pinging it in
+// the background. Stop closes the pool once acquired connections are released.
+type ManagedPool struct {
+	pool      *pgxpool.Pool
+	config    *ManagedPoolConfig
+	ready     chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closed    chan struct{}
+	stopOnce  sync.Once
+	closeOnce sync.Once
+	healthy   atomic.Bool
+	launched  atomic.Bool
+}
+
+// NewManagedPool creates a new ManagedPool using the provided connection
+// string. It does not connect to the database until Start is called.
+func NewManagedPool(
+	connStr string,
+	config *ManagedPoolConfig,
+	opts ...func(*pgxpool.Config),
+) (*ManagedPool, error) {
+	cfg, err := parsePoolConfig(connStr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("dbsql: failed to create a new database pool: %w", err)
+	}
+
+	if config == nil {
+		//nolint:exhaustruct
+		config = &ManagedPoolConfig{}
+	}
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	return &ManagedPool{
+		pool:   pool,
+		config: config,
+		ready:  make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Pool returns the underlying pool. It is safe to use once Ready is closed.
+func (p *ManagedPool) Pool() *pgxpool.Pool { return p.pool }
+
+// Ready returns a channel closed once the database is reachable.
+func (p *ManagedPool) Ready() <-chan struct{} { return p.ready }
+
+// Healthy reports whether the last health ping succeeded.
+func (p *ManagedPool) Healthy() bool { return p.healthy.Load() }
+
+// Start waits for the database to be reachable and then pings it
+// periodically until ctx is cancelled or Stop is called.
+//
+// It returns an error if the database is not reachable after
+// ManagedPoolConfig.MaxAttempts attempts.
+func (p *ManagedPool) Start(ctx context.Context) error {
+	if !p.launched.CompareAndSwap(false, true) {
+		return errors.New("dbsql: pool already launched")
+	}
+	defer close(p.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := p.connect(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return err
+	}
+
+	ticker := time.NewTicker(p.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.check(ctx)
+		}
+	}
+}
+
+// Stop stops the health pings and closes the pool, waiting for acquired
+// connections to be released until ctx is done.
+//
+// If ctx is done first, the pool keeps closing in the background once
+// the connections are released, and Stop can be called again to wait
+// for it.
+func (p *ManagedPool) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	if p.launched.Load() {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return fmt.Errorf("dbsql: failed to stop pool: %w", ctx.Err())
+		}
+	}
+
+	p.closeOnce.Do(func() {
+		go func() {
+			defer close(p.closed)
+			p.pool.Close()
+		}()
+	})
+
+	select {
+	case <-p.closed:
+		p.config.Logger.InfoContext(ctx, "Database pool closed")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("dbsql: failed to close pool gracefully: %w", ctx.Err())
+	}
+}
+
+// connect pings the database until it is reachable.
+func (p *ManagedPool) connect(ctx context.Context) error {
+	cfg := p.pool.Config().ConnConfig
+
+	for attempt := 1; ; attempt++ {
+		err := p.pool.Ping(ctx)
+		if err == nil {
+			p.healthy.Store(true)
+			close(p.ready)
+			p.config.Logger.InfoContext(
+				ctx,
+				"Connected to the database",
+				slog.String("host", cfg.Host),
+				slog.String("database", cfg.Database),
+				slog.Int("attempt", attempt),
+			)
+
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("dbsql: failed to connect to the database: %w", ctx.Err())
+		}
+
+		if attempt >= p.config.MaxAttempts {
+			return fmt.Errorf(
+				"dbsql: failed to connect to the database at %s after %d attempts: %w",
+				cfg.Host,
+				attempt,
+				err,
+			)
+		}
+
+		d := Backoff(attempt, p.config.MinBackoff, p.config.MaxBackoff)
+		p.config.Logger.WarnContext(
+			ctx,
+			"Failed to connect to the database",
+			slog.String("host", cfg.Host),
+			slog.String("database", cfg.Database),
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", d),
+			slog.Any("error", err),
+		)
+
+		if !sleep(ctx, d) {
+			return fmt.Errorf("dbsql: failed to connect to the database: %w", ctx.Err())
+		}
+	}
+}
+
+// check pings the database and logs health changes.
+func (p *ManagedPool) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.HealthInterval)
+	defer cancel()
+
+	err := p.pool.Ping(ctx)
+	if err != nil && ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+
+	healthy := err == nil
+	if p.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		p.config.Logger.InfoContext(ctx, "Database is healthy again")
+	} else {
+		p.config.Logger.ErrorContext(ctx, "Database health check failed", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,61 @@
+package dbsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagedPool(t *testing.T) {
+	const unreachable = "postgres://localhost:1/test?connect_timeout=1"
+
+	t.Run("it rejects invalid connection strings", func(t *testing.T) {
+		_, err := NewManagedPool("postgres://localhost:invalid", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("it gives up after max attempts", func(t *testing.T) {
+		p, err := NewManagedPool(unreachable, &ManagedPoolConfig{
+			MaxAttempts: 2,
+			MinBackoff:  time.Millisecond,
+			MaxBackoff:  time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		err = p.Start(context.Background())
+		require.ErrorContains(t, err, "after 2 attempts")
+		assert.False(t, p.Healthy())
+
+		select {
+		case <-p.Ready():
+			t.Fatal("expected pool not to be ready")
+		default:
+		}
+
+		require.NoError(t, p.Stop(context.Background()))
+		require.NoError(t, p.Stop(context.Background()))
+	})
+
+	t.Run("it stops while waiting for the database", func(t *testing.T) {
+		p, err := NewManagedPool(unreachable, &ManagedPoolConfig{
+			MaxAttempts: 1000,
+			MinBackoff:  time.Millisecond,
+			MaxBackoff:  time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- p.Start(context.Background()) }()
+
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		require.NoError(t, p.Stop(ctx))
+		require.NoError(t, <-errCh)
+	})
+}
@@ -0,0 +1,416 @@
+// Package migrate implements a schema migration runner on top of dbsql.
+//
+// Migrations are versioned .sql files read from an fs.FS, usually embedded
+// with go:embed. Each migration is applied in its own transaction and
+// recorded with its checksum in the schema table. A Postgres advisory lock
+// is held while migrating, so only one replica migrates at a time.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+)
+
+const (
+	// DefaultTable is the default name of the table recording applied migrations.
+	DefaultTable = "schema_migrations"
+
+	// DefaultLockKey is the default key of the advisory lock held while migrating.
+	DefaultLockKey int64 = 0x6d696772617465 // "migrate"
+)
+
+var (
+	ErrChecksumDrift = errors.New("migrate: checksum of applied migration has changed")
+	ErrOutOfOrder    = errors.New("migrate: pending migration is older than the latest applied one")
+	ErrMissingDown   = errors.New("migrate: missing down migration")
+	ErrUnknownTarget = errors.New("migrate: unknown target version")
+)
+
+// Config configures a Migrator.
+type Config struct {
+	// Logger is used to log migration progress.
+	Logger *slog.Logger
+
+	// Table is the name of the table recording applied migrations,
+	// optionally qualified with a schema. Defaults to DefaultTable.
+	Table string
+
+	// LockKey is the key of the advisory lock held while migrating.
+	// Defaults to DefaultLockKey.
+	LockKey int64
+
+	// AllowOutOfOrder allows applying pending migrations that are older
+	// than the latest applied one.
+	AllowOutOfOrder bool
+
+	// FailOnChecksumDrift makes migrating fail if an applied migration has
+	// been changed since it was applied, otherwise the drift is logged.
+	FailOnChecksumDrift bool
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Migrator"))
+	c.Table = cmp.Or(c.Table, DefaultTable)
+	c.LockKey = cmp.Or(c.LockKey, DefaultLockKey)
+}
+
+// Status is the status of a migration.
+type Status struct {
+	// AppliedAt is the time the migration was applied at.
+	AppliedAt time.Time
+
+	// Name is the name of the migration.
+	Name string
+
+	// Version is the version of the migration.
+	Version int64
+
+	// Applied reports whether the migration is applied.
+	Applied bool
+
+	// Drifted reports whether the migration has been changed since it was applied.
+	Drifted bool
+
+	// Missing reports whether the migration is applied, but is missing
+	// from the migration files.
+	Missing bool
+}
+
+// Migrator applies and reverts migrations.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	config     *Config
+	migrations []*Migration
+	table      string
+}
+
+// New creates a new Migrator for migrations read from fsys with Load.
+func New(pool *pgxpool.Pool, fsys fs.FS, config *Config) (*Migrator, error) {
+	debug.Assert(pool != nil, "expected pool to be defined")
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		//nolint:exhaustruct
+		config = &Config{}
+	}
+
+	config.defaults()
+
+	return &Migrator{
+		pool:       pool,
+		config:     config,
+		migrations: migrations,
+		table:      pgx.Identifier(strings.Split(config.Table, ".")).Sanitize(),
+	}, nil
+}
+
+// record is a row of the schema table.
+type record struct {
+	AppliedAt time.Time
+	Name      string
+	Checksum  string
+	Version   int64
+}
+
+// Up applies all pending migrations in order.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(ctx context.Context, conn *pgx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err := m.checkDrift(ctx, applied); err != nil {
+			return err
+		}
+
+		pending, err := plan(m.migrations, applied, m.config.AllowOutOfOrder)
+		if err != nil {
+			return err
+		}
+
+		if len(pending) == 0 {
+			m.config.Logger.InfoContext(ctx, "Database schema is up to date")
+			return nil
+		}
+
+		for _, mig := range pending {
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DownTo reverts applied migrations newer than version in reverse order.
+//
+// Use version 0 to revert all migrations.
+func (m *Migrator) DownTo(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("%w: %d", ErrUnknownTarget, version)
+	}
+
+	return m.withLock(ctx, func(ctx context.Context, conn *pgx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version <= version {
+				break
+			}
+
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status returns the status of all known and applied migrations ordered by version.
+//
+// It only reads the schema table, so it neither waits for a running migration
+// nor requires write access. If the table does not exist yet, all migrations
+// are reported as pending.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var exists bool
+	if err := m.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", m.table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrate: failed to look up schema table: %w", err)
+	}
+
+	if !exists {
+		return status(m.migrations, nil), nil
+	}
+
+	applied, err := m.applied(ctx, m.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return status(m.migrations, applied), nil
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(context.Context, *pgx.Conn) error) error {
+	return dbsql.WithLock(ctx, m.pool, m.config.LockKey, func(ctx context.Context, conn *pgxpool.Conn) error {
+		if _, err := conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version bigint PRIMARY KEY,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`, m.table)); err != nil {
+			return fmt.Errorf("migrate: failed to create schema table: %w", err)
+		}
+
+		return fn(ctx, conn.Conn())
+	})
+}
+
+func (m *Migrator) applied(ctx context.Context, db dbsql.DBTX) (map[int64]record, error) {
+	rows, err := db.Query(
+		ctx,
+		fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s ORDER BY version", m.table),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: failed to query applied migrations: %w", err)
+	}
+
+	records, err := pgx.CollectRows(rows, pgx.RowToStructByName[record])
+	if err != nil {
+		return nil, fmt.Errorf("migrate: failed to query applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) checkDrift(ctx context.Context, applied map[int64]record) error {
+	for _, s := range status(m.migrations, applied) {
+		switch {
+		case s.Drifted && m.config.FailOnChecksumDrift:
+			return fmt.Errorf("%w: %d_%s", ErrChecksumDrift, s.Version, s.Name)
+		case s.Drifted:
+			m.config.Logger.WarnContext(
+				ctx,
+				"Applied migration has been changed",
+				slog.Int64("version", s.Version),
+				slog.String("migration", s.Name),
+			)
+		case s.Missing:
+			m.config.Logger.WarnContext(
+				ctx,
+				"Applied migration is missing",
+				slog.Int64("version", s.Version),
+				slog.String("migration", s.Name),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *pgx.Conn, mig *Migration) error {
+	start := time.Now()
+
+	err := dbsql.WithTx(ctx, conn, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Up); err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+
+		_, err := tx.Exec(
+			ctx,
+			fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.table),
+			mig.Version,
+			mig.Name,
+			mig.Checksum,
+		)
+
+		return err //nolint:wrapcheck // wrapped below
+	}, dbsql.WithTxMaxAttempts(1))
+	if err != nil {
+		return fmt.Errorf("migrate: failed to apply migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	m.config.Logger.InfoContext(
+		ctx,
+		"Applied migration",
+		slog.Int64("version", mig.Version),
+		slog.String("migration", mig.Name),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *pgx.Conn, mig *Migration) error {
+	if mig.Down == "" {
+		return fmt.Errorf("%w: %d_%s", ErrMissingDown, mig.Version, mig.Name)
+	}
+
+	start := time.Now()
+
+	err := dbsql.WithTx(ctx, conn, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Down); err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+
+		_, err := tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table), mig.Version)
+
+		return err //nolint:wrapcheck // wrapped below
+	}, dbsql.WithTxMaxAttempts(1))
+	if err != nil {
+		return fmt.Errorf("migrate: failed to revert migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	m.config.Logger.InfoContext(
+		ctx,
+		"Reverted migration",
+		slog.Int64("version", mig.Version),
+		slog.String("migration", mig.Name),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	return nil
+}
+
+// plan returns migrations that need to be applied in order.
+func plan(migrations []*Migration, applied map[int64]record, allowOutOfOrder bool) ([]*Migration, error) {
+	var latest int64
+	for v := range applied {
+		latest = max(latest, v)
+	}
+
+	var pending []*Migration
+
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		if mig.Version < latest && !allowOutOfOrder {
+			return nil, fmt.Errorf("%w: %d_%s is older than %d", ErrOutOfOrder, mig.Version, mig.Name, latest)
+		}
+
+		pending = append(pending, mig)
+	}
+
+	return pending, nil
+}
+
+// status merges known migrations with applied ones.
+func status(migrations []*Migration, applied map[int64]record) []Status {
+	statuses := make([]Status, 0, len(migrations))
+	known := make(map[int64]struct{}, len(migrations))
+
+	for _, mig := range migrations {
+		known[mig.Version] = struct{}{}
+
+		//nolint:exhaustruct
+		s := Status{Name: mig.Name, Version: mig.Version}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = r.AppliedAt
+			s.Drifted = r.Checksum != mig.Checksum
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	for v, r := range applied {
+		if _, ok := known[v]; !ok {
+			statuses = append(statuses, Status{
+				AppliedAt: r.AppliedAt,
+				Name:      r.Name,
+				Version:   r.Version,
+				Applied:   true,
+				Drifted:   false,
+				Missing:   true,
+			})
+		}
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+
+	return statuses
+}
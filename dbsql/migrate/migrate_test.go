@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("orders migrations by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0002_add_email.up.sql":     {Data: []byte("ALTER TABLE users ADD email text;")},
+			"0002_add_email.down.sql":   {Data: []byte("ALTER TABLE users DROP email;")},
+			"0001_create_users.sql":     {Data: []byte("CREATE TABLE users (id int);")},
+			"0010_create_orders.up.sql": {Data: []byte("CREATE TABLE orders (id int);")},
+			"README.md":                 {Data: []byte("ignored")},
+		}
+
+		migrations, err := Load(fsys)
+		require.NoError(t, err)
+		require.Len(t, migrations, 3)
+
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "create_users", migrations[0].Name)
+		assert.Empty(t, migrations[0].Down)
+
+		assert.Equal(t, int64(2), migrations[1].Version)
+		assert.Equal(t, "add_email", migrations[1].Name)
+		assert.Equal(t, "ALTER TABLE users ADD email text;", migrations[1].Up)
+		assert.Equal(t, "ALTER TABLE users DROP email;", migrations[1].Down)
+		assert.Len(t, migrations[1].Checksum, 64)
+
+		assert.Equal(t, int64(10), migrations[2].Version)
+	})
+
+	t.Run("rejects duplicate versions", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_create_users.up.sql":  {Data: []byte("SELECT 1;")},
+			"0001_create_orders.up.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		_, err := Load(fsys)
+		require.ErrorIs(t, err, ErrDuplicateVersion)
+	})
+
+	t.Run("rejects missing up migration", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		}
+
+		_, err := Load(fsys)
+		require.ErrorIs(t, err, ErrMissingUp)
+	})
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "one", Checksum: "a"},
+		{Version: 2, Name: "two", Checksum: "b"},
+		{Version: 3, Name: "three", Checksum: "c"},
+	}
+
+	t.Run("returns pending migrations", func(t *testing.T) {
+		pending, err := plan(migrations, map[int64]record{1: {Version: 1}}, false)
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, int64(2), pending[0].Version)
+		assert.Equal(t, int64(3), pending[1].Version)
+	})
+
+	t.Run("refuses out-of-order migrations", func(t *testing.T) {
+		applied := map[int64]record{1: {Version: 1}, 3: {Version: 3}}
+
+		_, err := plan(migrations, applied, false)
+		require.ErrorIs(t, err, ErrOutOfOrder)
+
+		pending, err := plan(migrations, applied, true)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, int64(2), pending[0].Version)
+	})
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Now()
+	migrations := []*Migration{
+		{Version: 1, Name: "one", Checksum: "a"},
+		{Version: 2, Name: "two", Checksum: "b"},
+		{Version: 4, Name: "four", Checksum: "d"},
+	}
+	applied := map[int64]record{
+		1: {Version: 1, Name: "one", Checksum: "a", AppliedAt: now},
+		2: {Version: 2, Name: "two", Checksum: "changed", AppliedAt: now},
+		3: {Version: 3, Name: "three", Checksum: "c", AppliedAt: now},
+	}
+
+	statuses := status(migrations, applied)
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "one", Applied: true, AppliedAt: now},
+		{Version: 2, Name: "two", Applied: true, AppliedAt: now, Drifted: true},
+		{Version: 3, Name: "three", Applied: true, AppliedAt: now, Missing: true},
+		{Version: 4, Name: "four"},
+	}, statuses)
+
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "one"},
+		{Version: 2, Name: "two"},
+		{Version: 4, Name: "four"},
+	}, status(migrations, nil))
+}
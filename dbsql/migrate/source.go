@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("migrate: duplicate migration version")
+	ErrMissingUp        = errors.New("migrate: missing up migration")
+)
+
+// filenameRe matches migration files such as 0001_create_users.up.sql.
+// Files without the .up or .down suffix are treated as up migrations.
+var filenameRe = regexp.MustCompile(`^(\d+)_(.+?)(?:\.(up|down))?\.sql$`)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	// Name is the descriptive part of the migration file name.
+	Name string
+
+	// Up is the SQL applying the migration.
+	Up string
+
+	// Down is the SQL reverting the migration, it is empty if the migration
+	// cannot be reverted.
+	Down string
+
+	// Checksum is the SHA-256 checksum of Up.
+	Checksum string
+
+	// Version is the version of the migration.
+	Version int64
+}
+
+// Load reads migrations from the root of fsys ordered by their version.
+//
+// Migration files are named as <version>_<name>.up.sql and
+// <version>_<name>.down.sql, other files are ignored. Use fs.Sub to read
+// migrations from a subdirectory of an embedded file system.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: failed to read migrations: %w", err)
+	}
+
+	migrations := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := filenameRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version of migration %q: %w", entry.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: failed to read migration %q: %w", entry.Name(), err)
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			//nolint:exhaustruct
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: %d is used by %q and %q", ErrDuplicateVersion, version, m.Name, match[2])
+		}
+
+		if match[3] == "down" {
+			if m.Down != "" {
+				return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+			}
+
+			m.Down = string(b)
+
+			continue
+		}
+
+		if m.Checksum != "" {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		}
+
+		m.Up = string(b)
+		m.Checksum = checksum(b)
+	}
+
+	result := make([]*Migration, 0, len(migrations))
+
+	for _, m := range migrations {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrMissingUp, m.Version, m.Name)
+		}
+
+		result = append(result, m)
+	}
+
+	slices.SortFunc(result, func(a, b *Migration) int { return cmp.Compare(a.Version, b.Version) })
+
+	return result, nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
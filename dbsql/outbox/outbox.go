@@ -0,0 +1,143 @@
+// Package outbox implements the transactional outbox pattern on top of dbsql.
+//
+// Events are written to an outbox table within the same transaction as the
+// business changes that produce them, and a Relay delivers them to
+// a Publisher afterwards, so an event is never lost once the transaction
+// commits. Delivery is at least once, publishers must be idempotent.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"go.inout.gg/foundations/dbsql"
+)
+
+// DefaultTable is the default name of the outbox table.
+const DefaultTable = "outbox"
+
+// Message is an event to be written to the outbox.
+type Message struct {
+	// Payload is the event payload, it is encoded as JSON.
+	Payload any
+
+	// Headers are optional event metadata.
+	Headers map[string]string
+
+	// Topic is where the event is published to.
+	Topic string
+
+	// Key is an optional partitioning key of the event.
+	Key string
+}
+
+// Event is an event read from the outbox.
+type Event struct {
+	CreatedAt time.Time
+	Headers   map[string]string
+	Topic     string
+	Key       string
+	Payload   json.RawMessage
+	ID        int64
+	Attempts  int
+}
+
+// Outbox writes events to an outbox table.
+type Outbox struct {
+	table string
+	index string
+}
+
+// New creates a new Outbox writing to table, optionally qualified with
+// a schema. If table is empty, DefaultTable is used.
+func New(table string) *Outbox {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	ident := pgx.Identifier(strings.Split(table, "."))
+
+	return &Outbox{
+		table: ident.Sanitize(),
+		index: pgx.Identifier{strings.Join(ident, "_") + "_pending_idx"}.Sanitize(),
+	}
+}
+
+// Schema returns the DDL creating the outbox table, it is meant to be
+// included into the service's migrations.
+func (o *Outbox) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id bigserial PRIMARY KEY,
+	topic text NOT NULL,
+	key text NOT NULL DEFAULT '',
+	payload jsonb NOT NULL,
+	headers jsonb NOT NULL DEFAULT '{}',
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	sent_at timestamptz,
+	dead_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (next_attempt_at, id)
+	WHERE sent_at IS NULL AND dead_at IS NULL;
+`, o.table, o.index)
+}
+
+// Enqueue writes msgs to the outbox using db, which is typically
+// the transaction making the business changes.
+func (o *Outbox) Enqueue(ctx context.Context, db dbsql.DBTX, msgs ...Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	var (
+		query strings.Builder
+		args  = make([]any, 0, len(msgs)*4)
+	)
+
+	fmt.Fprintf(&query, "INSERT INTO %s (topic, key, payload, headers) VALUES ", o.table)
+
+	for i, msg := range msgs {
+		payload, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("outbox: failed to encode payload of %q event: %w", msg.Topic, err)
+		}
+
+		headers := msg.Headers
+		if headers == nil {
+			headers = map[string]string{}
+		}
+
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+
+		args = append(args, msg.Topic, msg.Key, payload, headers)
+	}
+
+	if _, err := db.Exec(ctx, query.String(), args...); err != nil {
+		return fmt.Errorf("outbox: failed to enqueue events: %w", err)
+	}
+
+	return nil
+}
+
+// Purge deletes events sent before t.
+func (o *Outbox) Purge(ctx context.Context, db dbsql.DBTX, t time.Time) (int64, error) {
+	tag, err := db.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE sent_at < $1", o.table), t)
+	if err != nil {
+		return 0, fmt.Errorf("outbox: failed to purge events: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/dbsql"
+)
+
+// execDB records executed statements.
+type execDB struct {
+	dbsql.DBTX
+
+	sql  string
+	args []any
+}
+
+func (db *execDB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	db.sql = sql
+	db.args = args
+
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("schema", func(t *testing.T) {
+		schema := New("").Schema()
+		assert.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "outbox"`)
+		assert.Contains(t, schema, `CREATE INDEX IF NOT EXISTS "outbox_pending_idx" ON "outbox"`)
+
+		schema = New("events.outbox").Schema()
+		assert.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "events"."outbox"`)
+		assert.Contains(t, schema, `CREATE INDEX IF NOT EXISTS "events_outbox_pending_idx" ON "events"."outbox"`)
+	})
+
+	t.Run("enqueue", func(t *testing.T) {
+		db := &execDB{}
+
+		err := New("").Enqueue(
+			context.Background(),
+			db,
+			Message{Topic: "user.created", Key: "1", Payload: map[string]int{"id": 1}},
+			Message{Topic: "user.deleted", Payload: map[string]int{"id": 2}, Headers: map[string]string{"v": "2"}},
+		)
+		require.NoError(t, err)
+
+		assert.Equal(
+			t,
+			`INSERT INTO "outbox" (topic, key, payload, headers) VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`,
+			db.sql,
+		)
+		assert.Equal(t, []any{
+			"user.created", "1", []byte(`{"id":1}`), map[string]string{},
+			"user.deleted", "", []byte(`{"id":2}`), map[string]string{"v": "2"},
+		}, db.args)
+	})
+
+	t.Run("enqueue nothing", func(t *testing.T) {
+		db := &execDB{}
+
+		require.NoError(t, New("").Enqueue(context.Background(), db))
+		assert.Empty(t, db.sql)
+	})
+
+	t.Run("enqueue invalid payload", func(t *testing.T) {
+		err := New("").Enqueue(context.Background(), &execDB{}, Message{Topic: "t", Payload: make(chan int)})
+		require.Error(t, err)
+	})
+}
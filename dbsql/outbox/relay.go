@@ -0,0 +1,302 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/startstop"
+)
+
+var _ startstop.Starter = (*Relay)(nil)
+
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = time.Second
+	DefaultMaxAttempts  = 10
+	DefaultMinBackoff   = time.Second
+	DefaultMaxBackoff   = time.Hour
+)
+
+// Publisher delivers events to a message broker.
+type Publisher interface {
+	Publish(context.Context, *Event) error
+}
+
+// PublisherFunc is an adapter to allow the use of ordinary functions as
+// publishers.
+type PublisherFunc func(context.Context, *Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e *Event) error { return f(ctx, e) }
+
+// RelayConfig configures a Relay.
+type RelayConfig struct {
+	// Logger is used to log delivery failures.
+	Logger *slog.Logger
+
+	// OnDead is called when an event is moved to the dead letter state
+	// after exhausting all delivery attempts.
+	OnDead func(ctx context.Context, e *Event, err error)
+
+	// BatchSize is the maximum number of events claimed at once.
+	BatchSize int
+
+	// MaxAttempts is the maximum number of delivery attempts of an event.
+	MaxAttempts int
+
+	// PollInterval is the interval between polls when the outbox is drained.
+	PollInterval time.Duration
+
+	// MinBackoff is the base delay before the second delivery attempt.
+	// The base delay doubles with each subsequent attempt, and the actual
+	// delay is picked at random from its upper half, see dbsql.Backoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between delivery attempts.
+	MaxBackoff time.Duration
+}
+
+func (c *RelayConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Relay"))
+	c.BatchSize = cmp.Or(c.BatchSize, DefaultBatchSize)
+	c.MaxAttempts = cmp.Or(c.MaxAttempts, DefaultMaxAttempts)
+	c.PollInterval = cmp.Or(c.PollInterval, DefaultPollInterval)
+	c.MinBackoff = cmp.Or(c.MinBackoff, DefaultMinBackoff)
+	c.MaxBackoff = cmp.Or(c.MaxBackoff, DefaultMaxBackoff)
+}
+
+// backoff returns a jittered delay before the next delivery attempt after
+// the given number of attempts.
+func (c *RelayConfig) backoff(attempts int) time.Duration {
+	return dbsql.Backoff(attempts, c.MinBackoff, c.MaxBackoff)
+}
+
+// Relay delivers events from the outbox to a Publisher.
+//
+// Events are claimed with FOR UPDATE SKIP LOCKED, so several replicas may
+// run a Relay concurrently. Failed deliveries are retried with jittered
+// exponential backoff, and events exhausting RelayConfig.MaxAttempts are
+// moved to the dead letter state. Events are delivered in order of their
+// creation, unless a delivery fails.
+type Relay struct {
+	outbox    *Outbox
+	pool      *pgxpool.Pool
+	publisher Publisher
+	config    *RelayConfig
+	stop      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+	launched  atomic.Bool
+}
+
+// NewRelay creates a new Relay delivering events from o to publisher.
+func (o *Outbox) NewRelay(pool *pgxpool.Pool, publisher Publisher, config *RelayConfig) *Relay {
+	debug.Assert(pool != nil, "expected pool to be defined")
+	debug.Assert(publisher != nil, "expected publisher to be defined")
+
+	if config == nil {
+		//nolint:exhaustruct
+		config = &RelayConfig{}
+	}
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	return &Relay{
+		outbox:    o,
+		pool:      pool,
+		publisher: publisher,
+		config:    config,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start delivers events until ctx is cancelled or Stop is called.
+func (r *Relay) Start(ctx context.Context) error {
+	if !r.launched.CompareAndSwap(false, true) {
+		return errors.New("outbox: relay already launched")
+	}
+	defer close(r.done)
+
+	for {
+		n, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.config.Logger.ErrorContext(ctx, "Failed to relay events", slog.Any("error", err))
+		}
+
+		// Keep going while there is a backlog.
+		delay := r.config.PollInterval
+		if err == nil && n == r.config.BatchSize {
+			delay = 0
+		}
+
+		t := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-r.stop:
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Stop stops the relay after the batch in flight is delivered.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	if !r.launched.Load() {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox: failed to stop relay: %w", ctx.Err())
+	}
+}
+
+// relay claims a batch of events and delivers them, returning the number
+// of claimed events.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	var (
+		n    int
+		dead []deadEvent
+	)
+
+	err := dbsql.WithTx(ctx, r.pool, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT id, topic, key, payload, headers, created_at, attempts
+FROM %s
+WHERE sent_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, r.outbox.table), r.config.BatchSize)
+		if err != nil {
+			return fmt.Errorf("outbox: failed to claim events: %w", err)
+		}
+
+		events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Event])
+		if err != nil {
+			return fmt.Errorf("outbox: failed to claim events: %w", err)
+		}
+
+		n = len(events)
+
+		sent := make([]int64, 0, len(events))
+
+		for _, e := range events {
+			if cause := r.publisher.Publish(ctx, e); cause != nil {
+				isDead, err := r.fail(ctx, tx, e, cause)
+				if err != nil {
+					return err
+				}
+
+				if isDead {
+					dead = append(dead, deadEvent{e, cause})
+				}
+
+				continue
+			}
+
+			sent = append(sent, e.ID)
+		}
+
+		if len(sent) == 0 {
+			return nil
+		}
+
+		if _, err := tx.Exec(
+			ctx,
+			fmt.Sprintf("UPDATE %s SET sent_at = now(), attempts = attempts + 1 WHERE id = ANY($1)", r.outbox.table),
+			sent,
+		); err != nil {
+			return fmt.Errorf("outbox: failed to mark events as sent: %w", err)
+		}
+
+		return nil
+	}, dbsql.WithTxMaxAttempts(1)) // events must not be published twice
+	if err != nil {
+		return n, err
+	}
+
+	if r.config.OnDead != nil {
+		for _, d := range dead {
+			r.config.OnDead(ctx, d.event, d.cause)
+		}
+	}
+
+	return n, nil
+}
+
+type deadEvent struct {
+	event *Event
+	cause error
+}
+
+// fail records a failed delivery attempt of e and reports whether e has been
+// moved to the dead letter state.
+func (r *Relay) fail(ctx context.Context, tx pgx.Tx, e *Event, cause error) (bool, error) {
+	attempts := e.Attempts + 1
+
+	if attempts >= r.config.MaxAttempts {
+		r.config.Logger.ErrorContext(
+			ctx,
+			"Event exhausted delivery attempts",
+			slog.Int64("id", e.ID),
+			slog.String("topic", e.Topic),
+			slog.Any("error", cause),
+		)
+
+		if _, err := tx.Exec(
+			ctx,
+			fmt.Sprintf("UPDATE %s SET attempts = $2, last_error = $3, dead_at = now() WHERE id = $1", r.outbox.table),
+			e.ID,
+			attempts,
+			cause.Error(),
+		); err != nil {
+			return false, fmt.Errorf("outbox: failed to mark event as dead: %w", err)
+		}
+
+		return true, nil
+	}
+
+	r.config.Logger.WarnContext(
+		ctx,
+		"Failed to publish event",
+		slog.Int64("id", e.ID),
+		slog.String("topic", e.Topic),
+		slog.Int("attempts", attempts),
+		slog.Any("error", cause),
+	)
+
+	if _, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(
+			"UPDATE %s SET attempts = $2, last_error = $3, next_attempt_at = now() + $4::interval WHERE id = $1",
+			r.outbox.table,
+		),
+		e.ID,
+		attempts,
+		cause.Error(),
+		r.config.backoff(attempts),
+	); err != nil {
+		return false, fmt.Errorf("outbox: failed to reschedule event: %w", err)
+	}
+
+	return false, nil
+}
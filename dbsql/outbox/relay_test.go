@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/foundations/dbsql/dbsqltest"
+)
+
+// fakePublisher records published events and fails with err, if set.
+type fakePublisher struct {
+	err    error
+	topics []string
+	mu     sync.Mutex
+}
+
+func (p *fakePublisher) Publish(_ context.Context, e *Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.topics = append(p.topics, e.Topic)
+
+	return nil
+}
+
+// outboxRow is the delivery state of an event.
+type outboxRow struct {
+	LastError *string
+	SentAt    *time.Time
+	DeadAt    *time.Time
+	Attempts  int
+	Pending   bool
+}
+
+//nolint:gochecknoglobals
+var testDB = dbsqltest.New(&dbsqltest.Config{
+	Prefix:      "outbox",
+	Fingerprint: New("").Schema(),
+	Migrate: func(ctx context.Context, pool *pgxpool.Pool) error {
+		_, err := pool.Exec(ctx, New("").Schema())
+		return err //nolint:wrapcheck // wrapped by dbsqltest
+	},
+})
+
+func readRow(t *testing.T, pool *pgxpool.Pool, id int64) outboxRow {
+	t.Helper()
+
+	var r outboxRow
+
+	err := pool.QueryRow(
+		context.Background(),
+		"SELECT last_error, sent_at, dead_at, attempts, next_attempt_at > now() FROM outbox WHERE id = $1",
+		id,
+	).Scan(&r.LastError, &r.SentAt, &r.DeadAt, &r.Attempts, &r.Pending)
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	o := New("")
+
+	t.Run("it publishes events in order", func(t *testing.T) {
+		pool := testDB.Pool(t)
+		pub := &fakePublisher{}
+
+		require.NoError(t, o.Enqueue(ctx, pool, Message{Topic: "a"}, Message{Topic: "b"}))
+
+		n, err := o.NewRelay(pool, pub, nil).relay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []string{"a", "b"}, pub.topics)
+
+		r := readRow(t, pool, 1)
+		assert.NotNil(t, r.SentAt)
+		assert.Equal(t, 1, r.Attempts)
+
+		n, err = o.NewRelay(pool, pub, nil).relay(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("it reschedules failed events", func(t *testing.T) {
+		pool := testDB.Pool(t)
+		pub := &fakePublisher{err: errors.New("broker is down")}
+		relay := o.NewRelay(pool, pub, &RelayConfig{MaxAttempts: 3, MinBackoff: time.Hour})
+
+		require.NoError(t, o.Enqueue(ctx, pool, Message{Topic: "a"}))
+
+		n, err := relay.relay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		r := readRow(t, pool, 1)
+		assert.Nil(t, r.SentAt)
+		assert.Nil(t, r.DeadAt)
+		assert.Equal(t, 1, r.Attempts)
+		assert.Equal(t, "broker is down", *r.LastError)
+		assert.True(t, r.Pending)
+
+		// The event is not due yet.
+		n, err = relay.relay(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		_, err = pool.Exec(ctx, "UPDATE outbox SET next_attempt_at = now()")
+		require.NoError(t, err)
+
+		pub.err = nil
+
+		n, err = relay.relay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"a"}, pub.topics)
+
+		r = readRow(t, pool, 1)
+		assert.NotNil(t, r.SentAt)
+		assert.Equal(t, 2, r.Attempts)
+	})
+
+	t.Run("it moves exhausted events to dead letters", func(t *testing.T) {
+		pool := testDB.Pool(t)
+		cause := errors.New("invalid event")
+		pub := &fakePublisher{err: cause}
+
+		var dead []error
+
+		relay := o.NewRelay(pool, pub, &RelayConfig{
+			MaxAttempts: 1,
+			OnDead: func(_ context.Context, e *Event, err error) {
+				assert.Equal(t, "a", e.Topic)
+				dead = append(dead, err)
+			},
+		})
+
+		require.NoError(t, o.Enqueue(ctx, pool, Message{Topic: "a"}))
+
+		n, err := relay.relay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []error{cause}, dead)
+
+		r := readRow(t, pool, 1)
+		assert.NotNil(t, r.DeadAt)
+		assert.Nil(t, r.SentAt)
+		assert.Equal(t, 1, r.Attempts)
+
+		_, err = pool.Exec(ctx, "UPDATE outbox SET next_attempt_at = now()")
+		require.NoError(t, err)
+
+		n, err = relay.relay(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("it skips events claimed by another relay", func(t *testing.T) {
+		pool := testDB.Pool(t)
+		pub := &fakePublisher{}
+
+		require.NoError(t, o.Enqueue(ctx, pool, Message{Topic: "a"}, Message{Topic: "b"}))
+
+		tx, err := pool.Begin(ctx)
+		require.NoError(t, err)
+
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		_, err = tx.Exec(ctx, "SELECT id FROM outbox WHERE id = 1 FOR UPDATE")
+		require.NoError(t, err)
+
+		n, err := o.NewRelay(pool, pub, nil).relay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"b"}, pub.topics)
+	})
+}
+
+func TestRelayConfigBackoff(t *testing.T) {
+	//nolint:exhaustruct
+	c := &RelayConfig{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 100: 5 * time.Second} {
+		d := c.backoff(attempts)
+		assert.GreaterOrEqual(t, d, want/2)
+		assert.LessOrEqual(t, d, want)
+	}
+}
@@ -31,6 +31,16 @@ func NewPool(
 	connStr string,
 	opts ...func(*pgxpool.Config),
 ) (*pgxpool.Pool, error) {
+	cfg, err := parsePoolConfig(connStr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPoolWithConfig(ctx, cfg)
+}
+
+// parsePoolConfig parses the connection string and applies opts to it.
+func parsePoolConfig(connStr string, opts ...func(*pgxpool.Config)) (*pgxpool.Config, error) {
 	cfg, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -43,7 +53,7 @@ func NewPool(
 		f(cfg)
 	}
 
-	return NewPoolWithConfig(ctx, cfg)
+	return cfg, nil
 }
 
 // NewPoolWithConfig creates a new connection pool using the provided configuration.
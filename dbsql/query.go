@@ -0,0 +1,376 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrTooManyRows is returned by QueryOne when the query returns more than
+// one row.
+var ErrTooManyRows = errors.New("dbsql: query returned more than one row")
+
+// NotFoundError is returned by QueryOne when the query returns no rows.
+//
+// It wraps pgx.ErrNoRows, so IsNotFoundError reports true for it.
+type NotFoundError struct {
+	// Type is the name of the type being queried.
+	Type string
+}
+
+func (e *NotFoundError) Error() string { return fmt.Sprintf("dbsql: %s not found", e.Type) }
+func (e *NotFoundError) Unwrap() error { return pgx.ErrNoRows }
+
+// QueryOne runs a query expected to return exactly one row and scans it into T.
+//
+// If T is a struct, columns are matched to its fields by name the same way as
+// pgx.RowToStructByName does, and columns without a corresponding field are
+// ignored. Otherwise the query must return a single column.
+// Structs that scan themselves, such as time.Time, sql.Null* and pgtype
+// types, are scanned from a single column too.
+// If the query returns no rows, a *NotFoundError is returned, and if it
+// returns more than one row, ErrTooManyRows is returned.
+func QueryOne[T any](ctx context.Context, db DBTX, sql string, args ...any) (T, error) {
+	return queryOne[T](ctx, db, false, sql, args)
+}
+
+// QueryOneStrict is like QueryOne, but fails if a column has no
+// corresponding struct field.
+func QueryOneStrict[T any](ctx context.Context, db DBTX, sql string, args ...any) (T, error) {
+	return queryOne[T](ctx, db, true, sql, args)
+}
+
+// QueryAll runs a query and scans all returned rows into T.
+//
+// See QueryOne for how rows are scanned.
+func QueryAll[T any](ctx context.Context, db DBTX, sql string, args ...any) ([]T, error) {
+	return collect(queryIter[T](ctx, db, false, sql, args))
+}
+
+// QueryAllStrict is like QueryAll, but fails if a column has no
+// corresponding struct field.
+func QueryAllStrict[T any](ctx context.Context, db DBTX, sql string, args ...any) ([]T, error) {
+	return collect(queryIter[T](ctx, db, true, sql, args))
+}
+
+// QueryIter runs a query and yields the returned rows scanned into T,
+// without holding all of them in memory.
+//
+// Iteration stops after the first error. The query runs when iteration
+// starts, and rows are closed when it stops. See QueryOne for how rows
+// are scanned.
+func QueryIter[T any](ctx context.Context, db DBTX, sql string, args ...any) iter.Seq2[T, error] {
+	return queryIter[T](ctx, db, false, sql, args)
+}
+
+// QueryIterStrict is like QueryIter, but fails if a column has no
+// corresponding struct field.
+func QueryIterStrict[T any](ctx context.Context, db DBTX, sql string, args ...any) iter.Seq2[T, error] {
+	return queryIter[T](ctx, db, true, sql, args)
+}
+
+func queryOne[T any](ctx context.Context, db DBTX, strict bool, sql string, args []any) (T, error) {
+	var zero T
+
+	rows, scan, err := query[T](ctx, db, strict, sql, args)
+	if err != nil {
+		return zero, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return zero, fmt.Errorf("dbsql: failed to query %s: %w", typeName[T](), err)
+		}
+
+		return zero, &NotFoundError{Type: typeName[T]()}
+	}
+
+	v, err := scan(rows)
+	if err != nil {
+		return zero, err
+	}
+
+	if rows.Next() {
+		return zero, fmt.Errorf("%w: %s", ErrTooManyRows, typeName[T]())
+	}
+
+	if err := rows.Err(); err != nil {
+		return zero, fmt.Errorf("dbsql: failed to query %s: %w", typeName[T](), err)
+	}
+
+	return v, nil
+}
+
+func queryIter[T any](ctx context.Context, db DBTX, strict bool, sql string, args []any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		rows, scan, err := query[T](ctx, db, strict, sql, args)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v, err := scan(rows)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			if !yield(v, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, fmt.Errorf("dbsql: failed to query %s: %w", typeName[T](), err))
+		}
+	}
+}
+
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var result []T
+
+	for v, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+// query runs a query and prepares a function scanning its rows into T.
+func query[T any](
+	ctx context.Context,
+	db DBTX,
+	strict bool,
+	sql string,
+	args []any,
+) (pgx.Rows, func(pgx.Rows) (T, error), error) {
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dbsql: failed to query %s: %w", typeName[T](), err)
+	}
+
+	scan, err := newRowScanner[T](rows, strict)
+	if err != nil {
+		rows.Close()
+		return nil, nil, err
+	}
+
+	return rows, scan, nil
+}
+
+// newRowScanner maps the columns of rows to T once and returns a function
+// scanning a single row.
+func newRowScanner[T any](rows pgx.Rows, strict bool) (func(pgx.Rows) (T, error), error) {
+	typ := reflect.TypeFor[T]()
+	columns := rows.FieldDescriptions()
+
+	if isScalar(typ) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("dbsql: expected 1 column to scan into %s, got %d", typ, len(columns))
+		}
+
+		return func(rows pgx.Rows) (T, error) {
+			var v T
+			if err := rows.Scan(&v); err != nil {
+				return v, fmt.Errorf("dbsql: failed to scan %s: %w", typ, err)
+			}
+
+			return v, nil
+		}, nil
+	}
+
+	fields := structFields(typ)
+	indexes := make([][]int, len(columns))
+
+	for i, column := range columns {
+		idx := fieldIndexByColumn(fields, column.Name)
+		if idx == nil && strict {
+			return nil, fmt.Errorf("dbsql: column %q has no corresponding field in %s", column.Name, typ)
+		}
+
+		indexes[i] = idx
+	}
+
+	return func(rows pgx.Rows) (T, error) {
+		var v T
+
+		value := reflect.ValueOf(&v).Elem()
+		dest := make([]any, len(indexes))
+
+		for i, idx := range indexes {
+			if idx != nil {
+				dest[i] = value.FieldByIndex(idx).Addr().Interface()
+			}
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return v, fmt.Errorf("dbsql: failed to scan %s: %w", typ, err)
+		}
+
+		return v, nil
+	}, nil
+}
+
+// scanner is the sql.Scanner interface.
+type scanner interface {
+	Scan(src any) error
+}
+
+//nolint:gochecknoglobals
+var scalarStructTypes = []reflect.Type{
+	reflect.TypeFor[time.Time](),
+}
+
+// scannerTypes are interfaces implemented by struct types scanned from
+// a single value, e.g. sql.NullString or pgtype.Text.
+//
+//nolint:gochecknoglobals
+var scannerTypes = []reflect.Type{
+	reflect.TypeFor[scanner](),
+	reflect.TypeFor[pgtype.BitsScanner](),
+	reflect.TypeFor[pgtype.BoolScanner](),
+	reflect.TypeFor[pgtype.BoxScanner](),
+	reflect.TypeFor[pgtype.BytesScanner](),
+	reflect.TypeFor[pgtype.CircleScanner](),
+	reflect.TypeFor[pgtype.CompositeIndexScanner](),
+	reflect.TypeFor[pgtype.DateScanner](),
+	reflect.TypeFor[pgtype.Float64Scanner](),
+	reflect.TypeFor[pgtype.HstoreScanner](),
+	reflect.TypeFor[pgtype.Int64Scanner](),
+	reflect.TypeFor[pgtype.IntervalScanner](),
+	reflect.TypeFor[pgtype.LineScanner](),
+	reflect.TypeFor[pgtype.LsegScanner](),
+	reflect.TypeFor[pgtype.NetipPrefixScanner](),
+	reflect.TypeFor[pgtype.NumericScanner](),
+	reflect.TypeFor[pgtype.PathScanner](),
+	reflect.TypeFor[pgtype.PointScanner](),
+	reflect.TypeFor[pgtype.PolygonScanner](),
+	reflect.TypeFor[pgtype.RangeScanner](),
+	reflect.TypeFor[pgtype.TextScanner](),
+	reflect.TypeFor[pgtype.TIDScanner](),
+	reflect.TypeFor[pgtype.TimeScanner](),
+	reflect.TypeFor[pgtype.TimestampScanner](),
+	reflect.TypeFor[pgtype.TimestamptzScanner](),
+	reflect.TypeFor[pgtype.Uint32Scanner](),
+	reflect.TypeFor[pgtype.Uint64Scanner](),
+	reflect.TypeFor[pgtype.UUIDScanner](),
+}
+
+// isScalar reports whether typ is scanned from a single column rather than
+// matched to columns field by field.
+//
+// Structs are scalar if they scan themselves, like time.Time, sql.Null*
+// and pgtype types.
+func isScalar(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct {
+		return true
+	}
+
+	if slices.Contains(scalarStructTypes, typ) {
+		return true
+	}
+
+	ptr := reflect.PointerTo(typ)
+
+	return slices.ContainsFunc(scannerTypes, ptr.Implements)
+}
+
+// structField is a field of a struct that a column can be scanned into.
+type structField struct {
+	name   string
+	index  []int
+	tagged bool
+}
+
+//nolint:gochecknoglobals
+var structFieldsCache sync.Map // map[reflect.Type][]structField
+
+// structFields returns the fields of typ following the rules of
+// pgx.RowToStructByName: exported fields are named by their db tag or by
+// their name, fields tagged with db:"-" are skipped, and fields of embedded
+// structs are promoted.
+func structFields(typ reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(typ); ok {
+		return fields.([]structField) //nolint:forcetypeassert // only []structField is stored
+	}
+
+	fields := appendStructFields(nil, typ, nil)
+	structFieldsCache.Store(typ, fields)
+
+	return fields
+}
+
+func appendStructFields(fields []structField, typ reflect.Type, index []int) []structField {
+	for i := range typ.NumField() {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		idx := append(index[:len(index):len(index)], i)
+		tag, tagged := sf.Tag.Lookup("db")
+
+		if tagged {
+			tag, _, _ = strings.Cut(tag, ",")
+		}
+
+		if tag == "-" {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && tag == "" {
+			fields = appendStructFields(fields, sf.Type, idx)
+			continue
+		}
+
+		if tag != "" {
+			fields = append(fields, structField{name: tag, index: idx, tagged: true})
+		} else {
+			fields = append(fields, structField{name: sf.Name, index: idx, tagged: false})
+		}
+	}
+
+	return fields
+}
+
+// fieldIndexByColumn returns the index of the field column is scanned into,
+// or nil if there is none.
+func fieldIndexByColumn(fields []structField, column string) []int {
+	normalized := strings.ReplaceAll(column, "_", "")
+
+	for _, f := range fields {
+		if f.tagged {
+			if f.name == column {
+				return f.index
+			}
+
+			continue
+		}
+
+		if strings.EqualFold(strings.ReplaceAll(f.name, "_", ""), normalized) {
+			return f.index
+		}
+	}
+
+	return nil
+}
+
+func typeName[T any]() string { return reflect.TypeFor[T]().String() }
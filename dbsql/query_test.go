@@ -0,0 +1,216 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRows yields fixed values.
+type fakeRows struct {
+	pgx.Rows
+
+	err     error
+	columns []string
+	values  [][]any
+	row     int
+	closed  bool
+}
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := make([]pgconn.FieldDescription, len(r.columns))
+	for i, name := range r.columns {
+		fields[i] = pgconn.FieldDescription{Name: name}
+	}
+
+	return fields
+}
+
+func (r *fakeRows) Next() bool {
+	if r.closed || r.row >= len(r.values) {
+		r.closed = true
+		return false
+	}
+
+	r.row++
+
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		if d != nil {
+			reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[r.row-1][i]))
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeRows) Err() error { return r.err }
+func (r *fakeRows) Close()     { r.closed = true }
+
+// nullString implements sql.Scanner like sql.NullString.
+type nullString struct {
+	String string
+	Valid  bool
+}
+
+func (s *nullString) Scan(src any) error {
+	s.String, s.Valid = src.(string)
+	return nil
+}
+
+// rowsDB returns rows for any query.
+type rowsDB struct {
+	DBTX
+
+	rows *fakeRows
+	args []any
+}
+
+func (db *rowsDB) Query(_ context.Context, _ string, args ...any) (pgx.Rows, error) {
+	db.args = args
+	return db.rows, nil
+}
+
+type Timestamps struct {
+	CreatedAt string
+}
+
+type user struct {
+	Timestamps
+
+	Name   string
+	Email  string `db:"email_address"`
+	Secret string `db:"-"`
+	ID     int
+}
+
+func TestQueryOne(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it scans by column name", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{
+			columns: []string{"id", "name", "email_address", "created_at", "unmapped"},
+			values:  [][]any{{1, "Alice", "alice@example.com", "today", true}},
+		}}
+
+		u, err := QueryOne[user](ctx, db, "SELECT", 1, pgx.QueryExecModeSimpleProtocol)
+		require.NoError(t, err)
+		assert.Equal(t, user{
+			Timestamps: Timestamps{CreatedAt: "today"},
+			Name:       "Alice",
+			Email:      "alice@example.com",
+			ID:         1,
+		}, u)
+		assert.Equal(t, []any{1, pgx.QueryExecModeSimpleProtocol}, db.args)
+		assert.True(t, db.rows.closed)
+	})
+
+	t.Run("it scans a single column", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{columns: []string{"count"}, values: [][]any{{42}}}}
+
+		n, err := QueryOne[int](ctx, db, "SELECT")
+		require.NoError(t, err)
+		assert.Equal(t, 42, n)
+	})
+
+	t.Run("it scans time.Time as a single column", func(t *testing.T) {
+		now := time.Now()
+		db := &rowsDB{rows: &fakeRows{columns: []string{"now"}, values: [][]any{{now}}}}
+
+		v, err := QueryOne[time.Time](ctx, db, "SELECT now()")
+		require.NoError(t, err)
+		assert.Equal(t, now, v)
+	})
+
+	t.Run("it scans scanner structs as a single column", func(t *testing.T) {
+		text := pgtype.Text{String: "Alice", Valid: true}
+		db := &rowsDB{rows: &fakeRows{columns: []string{"name"}, values: [][]any{{text}}}}
+
+		v, err := QueryOne[pgtype.Text](ctx, db, "SELECT name")
+		require.NoError(t, err)
+		assert.Equal(t, text, v)
+
+		null := nullString{String: "Bob", Valid: true}
+		db = &rowsDB{rows: &fakeRows{columns: []string{"name"}, values: [][]any{{null}}}}
+
+		s, err := QueryOne[nullString](ctx, db, "SELECT name")
+		require.NoError(t, err)
+		assert.Equal(t, null, s)
+	})
+
+	t.Run("it fails on unmapped columns in strict mode", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{columns: []string{"id", "unmapped"}, values: [][]any{{1, true}}}}
+
+		_, err := QueryOneStrict[user](ctx, db, "SELECT", 1)
+		require.ErrorContains(t, err, `column "unmapped"`)
+		assert.Equal(t, []any{1}, db.args)
+		assert.True(t, db.rows.closed)
+	})
+
+	t.Run("it returns not found error", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{columns: []string{"id"}}}
+
+		_, err := QueryOne[user](ctx, db, "SELECT")
+
+		var notFound *NotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "dbsql.user", notFound.Type)
+		assert.True(t, IsNotFoundError(err))
+	})
+
+	t.Run("it fails on too many rows", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{columns: []string{"id"}, values: [][]any{{1}, {2}}}}
+
+		_, err := QueryOne[user](ctx, db, "SELECT")
+		require.ErrorIs(t, err, ErrTooManyRows)
+	})
+}
+
+func TestQueryAll(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it scans all rows", func(t *testing.T) {
+		db := &rowsDB{rows: &fakeRows{columns: []string{"id"}, values: [][]any{{1}, {2}}}}
+
+		users, err := QueryAll[user](ctx, db, "SELECT")
+		require.NoError(t, err)
+		assert.Equal(t, []user{{ID: 1}, {ID: 2}}, users)
+	})
+
+	t.Run("it returns rows error", func(t *testing.T) {
+		errRows := errors.New("connection reset")
+		db := &rowsDB{rows: &fakeRows{columns: []string{"id"}, values: [][]any{{1}}, err: errRows}}
+
+		_, err := QueryAll[user](ctx, db, "SELECT")
+		require.ErrorIs(t, err, errRows)
+	})
+}
+
+func TestQueryIter(t *testing.T) {
+	db := &rowsDB{rows: &fakeRows{columns: []string{"id"}, values: [][]any{{1}, {2}, {3}}}}
+
+	var ids []int
+
+	for u, err := range QueryIter[user](context.Background(), db, "SELECT") {
+		require.NoError(t, err)
+
+		ids = append(ids, u.ID)
+		if len(ids) == 2 {
+			break
+		}
+	}
+
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.True(t, db.rows.closed)
+}
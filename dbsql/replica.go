@@ -0,0 +1,391 @@
+package dbsql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/startstop"
+)
+
+var (
+	_ DB                = (*ReplicaPool)(nil)
+	_ startstop.Starter = (*ReplicaPool)(nil)
+)
+
+const (
+	DefaultReplicaMaxLag        = 5 * time.Second
+	DefaultReplicaCheckInterval = 5 * time.Second
+)
+
+// replicationLagQuery measures how far a replica is behind its primary.
+// A replica that has replayed everything it received is considered
+// up to date, even if the primary has not written anything for a while.
+//
+// The lag is NULL if the WAL receiver is not streaming, as a disconnected
+// replica looks up to date otherwise. The status is only visible to roles
+// with pg_read_all_stats, for other roles a running receiver is trusted.
+const replicationLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN NOT EXISTS (
+		SELECT FROM pg_stat_wal_receiver WHERE status IS NULL OR status = 'streaming'
+	) THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+var errReplicaNotStreaming = errors.New("dbsql: replica is not streaming WAL")
+
+type readOnlyCtxKey struct{}
+
+type primaryCtxKey struct{}
+
+type writeTrackerCtxKey struct{}
+
+//nolint:gochecknoglobals
+var (
+	kReadOnlyCtxKey     = readOnlyCtxKey{}
+	kPrimaryCtxKey      = primaryCtxKey{}
+	kWriteTrackerCtxKey = writeTrackerCtxKey{}
+)
+
+// WithReadOnly returns a new context marking calls made with it as read-only,
+// so that ReplicaPool routes Exec and SendBatch to a replica as well.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, kReadOnlyCtxKey, true)
+}
+
+// WithPrimary returns a new context forcing ReplicaPool to route all calls
+// made with it to the primary, e.g. for INSERT ... RETURNING queries.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, kPrimaryCtxKey, true)
+}
+
+// WithReadYourWrites returns a new context tracking writes made through
+// ReplicaPool, so that reads made with it are pinned to the primary for
+// ReplicaPoolConfig.PinWindow after the last write.
+//
+// It is typically installed once per request or per user session.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, kWriteTrackerCtxKey, &writeTracker{})
+}
+
+// writeTracker records the time of the last write.
+type writeTracker struct{ last atomic.Int64 }
+
+// ReplicaPoolConfig configures a ReplicaPool.
+type ReplicaPoolConfig struct {
+	// Logger is used to log replica health changes.
+	Logger *slog.Logger
+
+	// MaxLag is the maximum replication lag of a replica serving reads.
+	MaxLag time.Duration
+
+	// PinWindow is how long reads are pinned to the primary after a write,
+	// see WithReadYourWrites. Defaults to MaxLag.
+	PinWindow time.Duration
+
+	// CheckInterval is the interval between replication lag checks.
+	CheckInterval time.Duration
+}
+
+func (c *ReplicaPoolConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "ReplicaPool"))
+	c.MaxLag = cmp.Or(c.MaxLag, DefaultReplicaMaxLag)
+	c.PinWindow = cmp.Or(c.PinWindow, c.MaxLag)
+	c.CheckInterval = cmp.Or(c.CheckInterval, DefaultReplicaCheckInterval)
+}
+
+// ReplicaPool routes reads to read replicas and everything else to the primary.
+//
+// Query and QueryRow made outside of a transaction go to a healthy replica,
+// as do Exec and SendBatch made with a WithReadOnly context. Everything else,
+// including transactions, goes to the primary. If no replica is healthy,
+// reads fall back to the primary. Calls routed to the primary count as
+// writes for WithReadYourWrites, including Query and QueryRow made with
+// a WithPrimary context, e.g. for INSERT ... RETURNING.
+//
+// Start runs a loop measuring the replication lag of each replica and takes
+// replicas lagging more than ReplicaPoolConfig.MaxLag out of rotation.
+type ReplicaPool struct {
+	primary  DB
+	config   *ReplicaPoolConfig
+	close    func()
+	stop     chan struct{}
+	done     chan struct{}
+	replicas []*replica
+	next     atomic.Uint64
+	stopOnce sync.Once
+	launched atomic.Bool
+}
+
+type replica struct {
+	db      DB
+	index   int
+	healthy atomic.Bool
+}
+
+// NewReplicaPool creates a new ReplicaPool for pools created with NewPool.
+func NewReplicaPool(primary *pgxpool.Pool, replicas []*pgxpool.Pool, config *ReplicaPoolConfig) *ReplicaPool {
+	debug.Assert(primary != nil, "expected primary to be defined")
+
+	dbs := make([]DB, len(replicas))
+	for i, r := range replicas {
+		dbs[i] = r
+	}
+
+	p := newReplicaPool(primary, dbs, config)
+	p.close = func() {
+		for _, r := range replicas {
+			r.Close()
+		}
+
+		primary.Close()
+	}
+
+	return p
+}
+
+func newReplicaPool(primary DB, replicas []DB, config *ReplicaPoolConfig) *ReplicaPool {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &ReplicaPoolConfig{}
+	}
+
+	config.defaults()
+
+	//nolint:exhaustruct
+	p := &ReplicaPool{
+		primary:  primary,
+		config:   config,
+		close:    func() {},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		replicas: make([]*replica, len(replicas)),
+	}
+
+	for i, db := range replicas {
+		//nolint:exhaustruct
+		r := &replica{db: db, index: i}
+		r.healthy.Store(true)
+		p.replicas[i] = r
+	}
+
+	return p
+}
+
+// Primary returns the primary database.
+func (p *ReplicaPool) Primary() DB { return p.primary }
+
+// Close closes the primary and all replica pools.
+func (p *ReplicaPool) Close() { p.close() }
+
+func (p *ReplicaPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if isReadOnly(ctx) {
+		return p.reader(ctx).Exec(ctx, sql, args...)
+	}
+
+	p.markWrite(ctx)
+
+	return p.primary.Exec(ctx, sql, args...)
+}
+
+func (p *ReplicaPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return p.queryer(ctx).Query(ctx, sql, args...)
+}
+
+func (p *ReplicaPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return p.queryer(ctx).QueryRow(ctx, sql, args...)
+}
+
+func (p *ReplicaPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if isReadOnly(ctx) {
+		return p.reader(ctx).SendBatch(ctx, b)
+	}
+
+	p.markWrite(ctx)
+
+	return p.primary.SendBatch(ctx, b)
+}
+
+func (p *ReplicaPool) CopyFrom(
+	ctx context.Context,
+	table pgx.Identifier,
+	columns []string,
+	src pgx.CopyFromSource,
+) (int64, error) {
+	p.markWrite(ctx)
+	return p.primary.CopyFrom(ctx, table, columns, src)
+}
+
+func (p *ReplicaPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	p.markWrite(ctx)
+	return p.primary.Begin(ctx)
+}
+
+func (p *ReplicaPool) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	p.markWrite(ctx)
+	return p.primary.BeginTx(ctx, opts)
+}
+
+// Start measures the replication lag of replicas until ctx is cancelled or
+// Stop is called.
+func (p *ReplicaPool) Start(ctx context.Context) error {
+	if !p.launched.CompareAndSwap(false, true) {
+		return errors.New("dbsql: replica pool already launched")
+	}
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops measuring the replication lag. It does not close the pools,
+// see Close.
+func (p *ReplicaPool) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	if !p.launched.Load() {
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("dbsql: failed to stop replica pool: %w", ctx.Err())
+	}
+}
+
+// check updates the health of all replicas.
+//
+// A replica that does not answer within CheckInterval is taken out of
+// rotation, nothing is updated if parent is done.
+func (p *ReplicaPool) check(parent context.Context) {
+	var wg sync.WaitGroup
+
+	for _, r := range p.replicas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(parent, p.config.CheckInterval)
+			defer cancel()
+
+			var lag *float64
+
+			err := r.db.QueryRow(ctx, replicationLagQuery).Scan(&lag)
+			if err != nil && parent.Err() != nil {
+				return
+			}
+
+			var lagDuration time.Duration
+			if err == nil && lag == nil {
+				err = errReplicaNotStreaming
+			} else if lag != nil {
+				lagDuration = time.Duration(*lag * float64(time.Second))
+			}
+
+			healthy := err == nil && lagDuration <= p.config.MaxLag
+
+			if r.healthy.Swap(healthy) == healthy {
+				return
+			}
+
+			if healthy {
+				p.config.Logger.InfoContext(ctx, "Replica is back in rotation", slog.Int("replica", r.index))
+			} else {
+				p.config.Logger.WarnContext(
+					ctx,
+					"Replica is taken out of rotation",
+					slog.Int("replica", r.index),
+					slog.Duration("lag", lagDuration),
+					slog.Any("error", err),
+				)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// reader returns the database serving reads made with ctx.
+func (p *ReplicaPool) reader(ctx context.Context) DB {
+	if len(p.replicas) == 0 || ctx.Value(kPrimaryCtxKey) != nil || p.pinned(ctx) {
+		return p.primary
+	}
+
+	if _, err := TxFromContext(ctx); err == nil {
+		return p.primary
+	}
+
+	n := uint64(len(p.replicas))
+	start := p.next.Add(1)
+
+	for i := range n {
+		if r := p.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+
+	return p.primary
+}
+
+// queryer returns the database serving Query and QueryRow made with ctx.
+//
+// Queries routed to the primary may write, e.g. INSERT ... RETURNING,
+// so they pin later reads.
+func (p *ReplicaPool) queryer(ctx context.Context) DB {
+	db := p.reader(ctx)
+	if db == p.primary {
+		p.markWrite(ctx)
+	}
+
+	return db
+}
+
+// pinned reports whether reads made with ctx are pinned to the primary
+// after a recent write.
+func (p *ReplicaPool) pinned(ctx context.Context) bool {
+	t, ok := ctx.Value(kWriteTrackerCtxKey).(*writeTracker)
+	if !ok {
+		return false
+	}
+
+	last := t.last.Load()
+
+	return last != 0 && time.Since(time.Unix(0, last)) < p.config.PinWindow
+}
+
+func (p *ReplicaPool) markWrite(ctx context.Context) {
+	if t, ok := ctx.Value(kWriteTrackerCtxKey).(*writeTracker); ok {
+		t.last.Store(time.Now().UnixNano())
+	}
+}
+
+func isReadOnly(ctx context.Context) bool {
+	return ctx.Value(kReadOnlyCtxKey) != nil && ctx.Value(kPrimaryCtxKey) == nil
+}
@@ -0,0 +1,189 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// lagRow is a pgx.Row returning replication lag in seconds.
+type lagRow struct {
+	ctx          context.Context //nolint:containedctx // the row blocks until the query is cancelled
+	err          error
+	lag          float64
+	hang         bool
+	disconnected bool
+}
+
+func (r lagRow) Scan(dest ...any) error {
+	if r.hang {
+		<-r.ctx.Done()
+		return r.ctx.Err()
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	if r.disconnected {
+		*dest[0].(**float64) = nil //nolint:forcetypeassert // the destination is known
+		return nil
+	}
+
+	lag := r.lag
+	*dest[0].(**float64) = &lag //nolint:forcetypeassert // the destination is known
+
+	return nil
+}
+
+// routeDB records which database served each call.
+type routeDB struct {
+	DB
+
+	calls        *[]string
+	err          error
+	name         string
+	lag          float64
+	hang         bool
+	disconnected bool
+}
+
+func (db *routeDB) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	*db.calls = append(*db.calls, db.name)
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *routeDB) QueryRow(ctx context.Context, sql string, _ ...any) pgx.Row {
+	if sql == replicationLagQuery {
+		return lagRow{ctx: ctx, lag: db.lag, err: db.err, hang: db.hang, disconnected: db.disconnected}
+	}
+
+	*db.calls = append(*db.calls, db.name)
+
+	return lagRow{}
+}
+
+func TestReplicaPool(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func() (*ReplicaPool, []*routeDB, *[]string) {
+		var calls []string
+
+		primary := &routeDB{name: "primary", calls: &calls}
+		replicas := []*routeDB{
+			{name: "replica-0", calls: &calls},
+			{name: "replica-1", calls: &calls},
+		}
+
+		p := newReplicaPool(primary, []DB{replicas[0], replicas[1]}, &ReplicaPoolConfig{
+			MaxLag:    time.Second,
+			PinWindow: time.Minute,
+		})
+
+		return p, replicas, &calls
+	}
+
+	t.Run("it routes reads to replicas and writes to primary", func(t *testing.T) {
+		p, _, calls := setup()
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		_ = p.QueryRow(ctx, "SELECT 1")
+		_, _ = p.Exec(ctx, "UPDATE t SET x = 1")
+		_, _ = p.Exec(WithReadOnly(ctx), "SELECT 1")
+		_ = p.QueryRow(WithPrimary(ctx), "SELECT 1")
+
+		assert.Equal(t, []string{"replica-1", "replica-0", "primary", "replica-1", "primary"}, *calls)
+	})
+
+	t.Run("it routes reads within a transaction to primary", func(t *testing.T) {
+		p, _, calls := setup()
+
+		_ = p.QueryRow(WithActiveTx(ctx, &fakeTx{}), "SELECT 1")
+
+		assert.Equal(t, []string{"primary"}, *calls)
+	})
+
+	t.Run("it pins reads to primary after a write", func(t *testing.T) {
+		p, _, calls := setup()
+		ctx := WithReadYourWrites(ctx)
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		_, _ = p.Exec(ctx, "UPDATE t SET x = 1")
+		_ = p.QueryRow(ctx, "SELECT 1")
+
+		assert.Equal(t, []string{"replica-1", "primary", "primary"}, *calls)
+	})
+
+	t.Run("it pins reads to primary after a query on primary", func(t *testing.T) {
+		p, _, calls := setup()
+		ctx := WithReadYourWrites(ctx)
+
+		_ = p.QueryRow(WithPrimary(ctx), "INSERT INTO t (x) VALUES (1) RETURNING id")
+		_ = p.QueryRow(ctx, "SELECT 1")
+
+		assert.Equal(t, []string{"primary", "primary"}, *calls)
+	})
+
+	t.Run("it skips lagging replicas", func(t *testing.T) {
+		p, replicas, calls := setup()
+
+		replicas[0].lag = 10
+		replicas[1].err = errors.New("connection refused")
+		p.check(ctx)
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		assert.Equal(t, []string{"primary"}, *calls)
+
+		replicas[0].lag = 0.5
+		p.check(ctx)
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		_ = p.QueryRow(ctx, "SELECT 1")
+		assert.Equal(t, []string{"primary", "replica-0", "replica-0"}, *calls)
+	})
+
+	t.Run("it skips disconnected replicas", func(t *testing.T) {
+		p, replicas, calls := setup()
+
+		replicas[0].disconnected = true
+		replicas[1].disconnected = true
+		p.check(ctx)
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		assert.Equal(t, []string{"primary"}, *calls)
+	})
+
+	t.Run("it skips hanging replicas", func(t *testing.T) {
+		var calls []string
+
+		primary := &routeDB{name: "primary", calls: &calls}
+		replica := &routeDB{name: "replica", calls: &calls, hang: true}
+		p := newReplicaPool(primary, []DB{replica}, &ReplicaPoolConfig{
+			CheckInterval: 10 * time.Millisecond,
+		})
+
+		p.check(ctx)
+
+		_ = p.QueryRow(ctx, "SELECT 1")
+		assert.Equal(t, []string{"primary"}, calls)
+	})
+
+	t.Run("it keeps replica health when cancelled", func(t *testing.T) {
+		p, replicas, calls := setup()
+
+		replicas[0].hang = true
+		replicas[1].hang = true
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		p.check(ctx)
+
+		_ = p.QueryRow(context.Background(), "SELECT 1")
+		assert.Equal(t, []string{"replica-1"}, *calls)
+	})
+}
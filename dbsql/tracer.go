@@ -0,0 +1,292 @@
+package dbsql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	_ pgx.QueryTracer    = (*Tracer)(nil)
+	_ pgx.BatchTracer    = (*Tracer)(nil)
+	_ pgx.CopyFromTracer = (*Tracer)(nil)
+	_ pgx.ConnectTracer  = (*Tracer)(nil)
+)
+
+const tracerName = "go.inout.gg/foundations/dbsql"
+
+// DefaultSlowQueryThreshold is the default duration after which a query is
+// logged as slow.
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+type traceCtxKey struct{}
+
+//nolint:gochecknoglobals
+var kTraceCtxKey = traceCtxKey{}
+
+// TracerConfig configures a Tracer.
+type TracerConfig struct {
+	// Logger is used to log queries.
+	Logger *slog.Logger
+
+	// Provider is used to create spans, defaults to the global provider.
+	Provider trace.TracerProvider
+
+	// SlowThreshold is the duration after which a query is logged as slow
+	// with a warning, defaults to DefaultSlowQueryThreshold.
+	SlowThreshold time.Duration
+
+	// Level is the level queries that are neither slow nor failed are
+	// logged at, defaults to slog.LevelDebug.
+	Level slog.Leveler
+}
+
+func (c *TracerConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, slog.Default().With("name", "Tracer"))
+	c.Provider = cmp.Or(c.Provider, otel.GetTracerProvider())
+	c.SlowThreshold = cmp.Or(c.SlowThreshold, DefaultSlowQueryThreshold)
+	c.Level = cmp.Or[slog.Leveler](c.Level, slog.LevelDebug)
+}
+
+// Tracer logs queries, batches, copies and connects with slog, and records
+// them as OpenTelemetry spans following the database semantic conventions.
+//
+// Argument values are never logged nor recorded, only their count.
+//
+// Use it with WithTracer.
+type Tracer struct {
+	config *TracerConfig
+	tracer trace.Tracer
+}
+
+// NewTracer creates a new Tracer.
+func NewTracer(config *TracerConfig) *Tracer {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &TracerConfig{}
+	}
+
+	config.defaults()
+
+	return &Tracer{
+		config: config,
+		tracer: config.Provider.Tracer(tracerName, trace.WithSchemaURL(semconv.SchemaURL)),
+	}
+}
+
+// traceData is the state of a traced operation carried between its start
+// and end events.
+type traceData struct {
+	start time.Time
+	span  trace.Span
+	attrs []slog.Attr
+}
+
+func (t *Tracer) start(
+	ctx context.Context,
+	name string,
+	serverAttrs []attribute.KeyValue,
+	attrs []attribute.KeyValue,
+	logAttrs ...slog.Attr,
+) context.Context {
+	attrs = append(attrs, semconv.DBSystemNamePostgreSQL)
+	attrs = append(attrs, serverAttrs...)
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	return context.WithValue(ctx, kTraceCtxKey, &traceData{start: time.Now(), span: span, attrs: logAttrs})
+}
+
+func (t *Tracer) end(ctx context.Context, msg string, err error, attrs ...slog.Attr) {
+	data, ok := ctx.Value(kTraceCtxKey).(*traceData)
+	if !ok {
+		return
+	}
+
+	duration := time.Since(data.start)
+
+	attrs = append(data.attrs, append(attrs, slog.Duration("duration", duration))...)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			data.span.SetAttributes(semconv.DBResponseStatusCode(pgErr.Code), semconv.ErrorTypeKey.String(pgErr.Code))
+		} else {
+			data.span.SetAttributes(semconv.ErrorTypeKey.String("_OTHER"))
+		}
+
+		data.span.RecordError(err)
+		data.span.SetStatus(codes.Error, err.Error())
+		data.span.End()
+
+		t.config.Logger.LogAttrs(ctx, slog.LevelError, msg+" failed", append(attrs, slog.Any("error", err))...)
+
+		return
+	}
+
+	data.span.End()
+
+	if duration >= t.config.SlowThreshold {
+		t.config.Logger.LogAttrs(ctx, slog.LevelWarn, "Slow "+strings.ToLower(msg), attrs...)
+		return
+	}
+
+	t.config.Logger.LogAttrs(ctx, t.config.Level.Level(), msg, attrs...)
+}
+
+func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	op := operationName(data.SQL)
+
+	return t.start(
+		ctx,
+		cmp.Or(op, "postgresql"),
+		connAttributes(conn),
+		[]attribute.KeyValue{semconv.DBQueryText(data.SQL), semconv.DBOperationName(op)},
+		slog.String("sql", data.SQL),
+		slog.Int("args", len(data.Args)),
+	)
+}
+
+func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, "Query", data.Err, slog.Int64("rows", data.CommandTag.RowsAffected()))
+}
+
+func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	size := data.Batch.Len()
+
+	return t.start(
+		ctx,
+		"BATCH",
+		connAttributes(conn),
+		[]attribute.KeyValue{semconv.DBOperationName("BATCH"), semconv.DBOperationBatchSize(size)},
+		slog.Int("size", size),
+	)
+}
+
+func (t *Tracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	attrs := []slog.Attr{
+		slog.String("sql", data.SQL),
+		slog.Int("args", len(data.Args)),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+
+	if data.Err != nil {
+		t.config.Logger.LogAttrs(ctx, slog.LevelError, "Batch query failed", append(attrs, slog.Any("error", data.Err))...)
+		return
+	}
+
+	t.config.Logger.LogAttrs(ctx, t.config.Level.Level(), "Batch query", attrs...)
+}
+
+func (t *Tracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.end(ctx, "Batch", data.Err)
+}
+
+func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	table := data.TableName.Sanitize()
+
+	return t.start(
+		ctx,
+		"COPY "+table,
+		connAttributes(conn),
+		[]attribute.KeyValue{semconv.DBOperationName("COPY"), semconv.DBCollectionName(table)},
+		slog.String("table", table),
+		slog.Any("columns", data.ColumnNames),
+	)
+}
+
+func (t *Tracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, "Copy", data.Err, slog.Int64("rows", data.CommandTag.RowsAffected()))
+}
+
+func (t *Tracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	return t.start(
+		ctx,
+		"connect",
+		serverAttributes(data.ConnConfig),
+		nil,
+		slog.String("host", data.ConnConfig.Host),
+		slog.String("database", data.ConnConfig.Database),
+	)
+}
+
+func (t *Tracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	t.end(ctx, "Connect", data.Err)
+}
+
+// connAttributesKey is the key of server attributes cached in the custom
+// data of a connection.
+const connAttributesKey = tracerName + ".attributes"
+
+// connAttributes returns the server attributes of conn.
+//
+// conn.Config returns a deep copy of the configuration, so the attributes are
+// computed once per connection and cached in its custom data.
+func connAttributes(conn *pgx.Conn) []attribute.KeyValue {
+	if conn == nil {
+		return nil
+	}
+
+	data := conn.PgConn().CustomData()
+	if attrs, ok := data[connAttributesKey].([]attribute.KeyValue); ok {
+		return attrs
+	}
+
+	attrs := serverAttributes(conn.Config())
+	data[connAttributesKey] = attrs
+
+	return attrs
+}
+
+func serverAttributes(config *pgx.ConnConfig) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.DBNamespace(config.Database),
+		semconv.ServerAddress(config.Host),
+		semconv.ServerPort(int(config.Port)),
+	}
+}
+
+// operationName returns the leading keyword of sql, such as SELECT,
+// skipping leading comments.
+func operationName(sql string) string {
+	for {
+		sql = strings.TrimSpace(sql)
+
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			i := strings.IndexByte(sql, '\n')
+			if i < 0 {
+				return ""
+			}
+
+			sql = sql[i+1:]
+		case strings.HasPrefix(sql, "/*"):
+			i := strings.Index(sql, "*/")
+			if i < 0 {
+				return ""
+			}
+
+			sql = sql[i+2:]
+		default:
+			end := strings.IndexFunc(sql, func(r rune) bool {
+				return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z')
+			})
+			if end < 0 {
+				end = len(sql)
+			}
+
+			return strings.ToUpper(sql[:end])
+		}
+	}
+}
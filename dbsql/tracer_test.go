@@ -0,0 +1,123 @@
+package dbsql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(config *TracerConfig) (*Tracer, func() []map[string]any) {
+		var buf bytes.Buffer
+
+		config.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		return NewTracer(config), func() []map[string]any {
+			var records []map[string]any
+
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var r map[string]any
+				require.NoError(t, dec.Decode(&r))
+				records = append(records, r)
+			}
+
+			return records
+		}
+	}
+
+	t.Run("it logs queries without argument values", func(t *testing.T) {
+		tracer, records := setup(&TracerConfig{})
+
+		qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+			SQL:  "SELECT * FROM users WHERE email = $1",
+			Args: []any{"secret@example.com"},
+		})
+		tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+		logs := records()
+		require.Len(t, logs, 1)
+		assert.Equal(t, "DEBUG", logs[0]["level"])
+		assert.Equal(t, "Query", logs[0]["msg"])
+		assert.Equal(t, "SELECT * FROM users WHERE email = $1", logs[0]["sql"])
+		assert.InDelta(t, 1, logs[0]["args"], 0)
+		assert.InDelta(t, 1, logs[0]["rows"], 0)
+		assert.NotContains(t, fmt.Sprint(logs[0]), "secret@example.com")
+	})
+
+	t.Run("it warns about slow queries", func(t *testing.T) {
+		tracer, records := setup(&TracerConfig{SlowThreshold: time.Nanosecond})
+
+		qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+		time.Sleep(time.Millisecond)
+		tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{})
+
+		logs := records()
+		require.Len(t, logs, 1)
+		assert.Equal(t, "WARN", logs[0]["level"])
+		assert.Equal(t, "Slow query", logs[0]["msg"])
+	})
+
+	t.Run("it logs failures", func(t *testing.T) {
+		tracer, records := setup(&TracerConfig{})
+
+		bctx := tracer.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{Batch: &pgx.Batch{}})
+		tracer.TraceBatchQuery(bctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+		tracer.TraceBatchEnd(bctx, nil, pgx.TraceBatchEndData{Err: errors.New("connection reset")})
+
+		cctx := tracer.TraceConnectStart(ctx, pgx.TraceConnectStartData{ConnConfig: &pgx.ConnConfig{}})
+		tracer.TraceConnectEnd(cctx, pgx.TraceConnectEndData{Err: &pgconn.PgError{Code: ErrCodeTooManyConnections}})
+
+		logs := records()
+		require.Len(t, logs, 3)
+		assert.Equal(t, "Batch query", logs[0]["msg"])
+		assert.Equal(t, "ERROR", logs[1]["level"])
+		assert.Equal(t, "Batch failed", logs[1]["msg"])
+		assert.Equal(t, "connection reset", logs[1]["error"])
+		assert.Equal(t, "Connect failed", logs[2]["msg"])
+	})
+
+	t.Run("it logs at configured level", func(t *testing.T) {
+		tracer, records := setup(&TracerConfig{Level: slog.LevelInfo})
+
+		cctx := tracer.TraceCopyFromStart(ctx, nil, pgx.TraceCopyFromStartData{
+			TableName:   pgx.Identifier{"users"},
+			ColumnNames: []string{"id"},
+		})
+		tracer.TraceCopyFromEnd(cctx, nil, pgx.TraceCopyFromEndData{CommandTag: pgconn.NewCommandTag("COPY 10")})
+
+		logs := records()
+		require.Len(t, logs, 1)
+		assert.Equal(t, "INFO", logs[0]["level"])
+		assert.Equal(t, "Copy", logs[0]["msg"])
+		assert.Equal(t, `"users"`, logs[0]["table"])
+		assert.InDelta(t, 10, logs[0]["rows"], 0)
+	})
+}
+
+func TestOperationName(t *testing.T) {
+	tests := map[string]string{
+		"SELECT 1":                              "SELECT",
+		"  insert into users values ($1)":       "INSERT",
+		"-- name: GetUser\nSELECT * FROM users": "SELECT",
+		"/* comment */ WITH t AS (SELECT 1)":    "WITH",
+		"-- unterminated":                       "",
+		"":                                      "",
+	}
+
+	for sql, want := range tests {
+		assert.Equal(t, want, operationName(sql), sql)
+	}
+}
@@ -0,0 +1,140 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxFunc is a function executed within a transaction.
+type TxFunc func(ctx context.Context, tx pgx.Tx) error
+
+// TxConfig configures how WithTx retries transactions.
+type TxConfig struct {
+	// MaxAttempts is the maximum number of attempts to run a transaction,
+	// defaults to 3.
+	MaxAttempts int
+
+	// MinBackoff is the base delay between attempts, defaults to 10ms.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between attempts, defaults to 1s.
+	MaxBackoff time.Duration
+}
+
+func (c *TxConfig) defaults() {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 10 * time.Millisecond
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Second
+	}
+}
+
+// backoff returns a jittered delay before the next attempt.
+func (c *TxConfig) backoff(attempt int) time.Duration {
+	return Backoff(attempt, c.MinBackoff, c.MaxBackoff)
+}
+
+// WithTxMaxAttempts sets the maximum number of attempts to run a transaction.
+func WithTxMaxAttempts(n int) func(*TxConfig) {
+	return func(c *TxConfig) { c.MaxAttempts = n }
+}
+
+// WithTxBackoff sets the base and the maximum delay between attempts.
+func WithTxBackoff(minBackoff, maxBackoff time.Duration) func(*TxConfig) {
+	return func(c *TxConfig) {
+		c.MinBackoff = minBackoff
+		c.MaxBackoff = maxBackoff
+	}
+}
+
+// WithTx runs fn within a transaction started on db with the given options.
+//
+// The transaction is committed if fn returns nil, and rolled back if fn
+// returns an error or panics, in which case the panic is propagated.
+// The whole transaction is retried with jittered exponential backoff on
+// serialization failures and deadlocks, so fn must be safe to call again.
+//
+// The context passed to fn carries the transaction, see TxFromContext and
+// DBTXFromContext.
+//
+// If db is already a transaction, fn is run within a SAVEPOINT of that
+// transaction instead, txOpts are ignored and no retries are made, as these
+// errors abort the enclosing transaction.
+//
+// The transaction is always started on db, even if ctx carries another
+// active transaction. To join it, pass the result of DBTXFromContext as db.
+func WithTx(ctx context.Context, db DBTX, txOpts pgx.TxOptions, fn TxFunc, opts ...func(*TxConfig)) error {
+	if tx, ok := db.(pgx.Tx); ok {
+		return runTx(ctx, fn, func(ctx context.Context) (pgx.Tx, error) { return tx.Begin(ctx) })
+	}
+
+	begin := func(ctx context.Context) (pgx.Tx, error) { return db.Begin(ctx) }
+	if db, ok := db.(DB); ok {
+		begin = func(ctx context.Context) (pgx.Tx, error) { return db.BeginTx(ctx, txOpts) }
+	}
+
+	//nolint:exhaustruct
+	cfg := TxConfig{}
+	for _, f := range opts {
+		f(&cfg)
+	}
+
+	cfg.defaults()
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, fn, begin)
+		if err == nil || attempt >= cfg.MaxAttempts || !isTxRetryable(err) {
+			return err
+		}
+
+		if !sleep(ctx, cfg.backoff(attempt)) {
+			return fmt.Errorf("dbsql: transaction retry cancelled: %w", errors.Join(ctx.Err(), err))
+		}
+	}
+}
+
+// runTx runs fn within a single transaction started by begin.
+func runTx(ctx context.Context, fn TxFunc, begin func(context.Context) (pgx.Tx, error)) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return fmt.Errorf("dbsql: failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			panic(p)
+		}
+	}()
+
+	if err := fn(WithActiveTx(ctx, tx), tx); err != nil {
+		if rerr := tx.Rollback(context.WithoutCancel(ctx)); rerr != nil && !errors.Is(rerr, pgx.ErrTxClosed) {
+			return errors.Join(err, fmt.Errorf("dbsql: failed to rollback transaction: %w", rerr))
+		}
+
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("dbsql: failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// isTxRetryable reports whether the transaction failed with an error that
+// can be resolved by retrying it.
+func isTxRetryable(err error) bool {
+	class := ClassifyError(err).Class
+	return class == ClassSerializationFailure || class == ClassDeadlock
+}
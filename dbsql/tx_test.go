@@ -0,0 +1,178 @@
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx records how the transaction was finished.
+type fakeTx struct {
+	pgx.Tx
+
+	db *fakeDB
+}
+
+func (tx *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	tx.db.savepoints++
+	return &fakeTx{Tx: nil, db: tx.db}, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.db.commits++
+	return tx.db.commitErr
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	tx.db.rollbacks++
+	return nil
+}
+
+// fakeDB starts fake transactions.
+type fakeDB struct {
+	DB
+
+	commitErr  error
+	txOpts     pgx.TxOptions
+	begins     int
+	commits    int
+	rollbacks  int
+	savepoints int
+}
+
+func (db *fakeDB) BeginTx(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	db.begins++
+	db.txOpts = opts
+
+	return &fakeTx{Tx: nil, db: db}, nil
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	fast := WithTxBackoff(time.Microsecond, time.Millisecond)
+	serializationErr := &pgconn.PgError{Code: ErrCodeSerializationFailure}
+
+	t.Run("it commits", func(t *testing.T) {
+		db := &fakeDB{}
+		opts := pgx.TxOptions{IsoLevel: pgx.Serializable}
+
+		err := WithTx(ctx, db, opts, func(context.Context, pgx.Tx) error { return nil })
+		require.NoError(t, err)
+		assert.Equal(t, 1, db.commits)
+		assert.Zero(t, db.rollbacks)
+		assert.Equal(t, opts, db.txOpts)
+	})
+
+	t.Run("it rolls back on error", func(t *testing.T) {
+		db := &fakeDB{}
+		errFn := errors.New("fn failed")
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error { return errFn })
+		require.ErrorIs(t, err, errFn)
+		assert.Equal(t, 1, db.begins)
+		assert.Equal(t, 1, db.rollbacks)
+		assert.Zero(t, db.commits)
+	})
+
+	t.Run("it rolls back on panic", func(t *testing.T) {
+		db := &fakeDB{}
+
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error { panic("boom") })
+		})
+		assert.Equal(t, 1, db.rollbacks)
+	})
+
+	t.Run("it retries serialization failures", func(t *testing.T) {
+		db := &fakeDB{}
+		attempts := 0
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error {
+			attempts++
+			if attempts < 3 {
+				return serializationErr
+			}
+
+			return nil
+		}, fast)
+		require.NoError(t, err)
+		assert.Equal(t, 3, db.begins)
+		assert.Equal(t, 2, db.rollbacks)
+		assert.Equal(t, 1, db.commits)
+	})
+
+	t.Run("it retries failed commits", func(t *testing.T) {
+		db := &fakeDB{commitErr: &pgconn.PgError{Code: ErrCodeDeadlockDetected}}
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error { return nil }, fast)
+		require.Error(t, err)
+		assert.Equal(t, 3, db.begins)
+	})
+
+	t.Run("it gives up after max attempts", func(t *testing.T) {
+		db := &fakeDB{}
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error {
+			return serializationErr
+		}, fast, WithTxMaxAttempts(5))
+		require.ErrorIs(t, err, serializationErr)
+		assert.Equal(t, 5, db.begins)
+	})
+
+	t.Run("it uses savepoints within a transaction", func(t *testing.T) {
+		db := &fakeDB{}
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+			return WithTx(ctx, tx, pgx.TxOptions{}, func(context.Context, pgx.Tx) error {
+				return serializationErr
+			}, fast)
+		}, WithTxMaxAttempts(1))
+		require.ErrorIs(t, err, serializationErr)
+		assert.Equal(t, 1, db.begins)
+		assert.Equal(t, 1, db.savepoints)
+		assert.Equal(t, 2, db.rollbacks)
+	})
+
+	t.Run("it passes the transaction in context", func(t *testing.T) {
+		db := &fakeDB{}
+
+		err := WithTx(ctx, db, pgx.TxOptions{}, func(ctx context.Context, outer pgx.Tx) error {
+			got, err := TxFromContext(ctx)
+			require.NoError(t, err)
+			assert.Same(t, outer, got)
+
+			dbtx, err := DBTXFromContext(ctx)
+			require.NoError(t, err)
+
+			return WithTx(ctx, dbtx, pgx.TxOptions{}, func(ctx context.Context, inner pgx.Tx) error {
+				got, err := DBTXFromContext(ctx)
+				require.NoError(t, err)
+				assert.Same(t, inner, got)
+
+				return nil
+			})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, db.begins)
+		assert.Equal(t, 1, db.savepoints)
+		assert.Equal(t, 2, db.commits)
+	})
+
+	t.Run("it starts the transaction on db regardless of context", func(t *testing.T) {
+		outer, db := &fakeDB{}, &fakeDB{}
+
+		err := WithTx(ctx, outer, pgx.TxOptions{}, func(ctx context.Context, _ pgx.Tx) error {
+			return WithTx(ctx, db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error { return nil })
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, outer.begins)
+		assert.Equal(t, 0, outer.savepoints)
+		assert.Equal(t, 1, db.begins)
+	})
+}